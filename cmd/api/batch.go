@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// The maximum number of movies which can be created in a single batch request.
+const maxBatchSize = 1000
+
+// Define constants for the status of each movie in a batch response.
+const (
+	batchStatusCreated = "created"
+	batchStatusInvalid = "invalid"
+	batchStatusSkipped = "skipped"
+)
+
+// A batchResult reports what happened to the movie at a given index of the request
+// body. Valid movies are "skipped" when the batch is all-or-nothing and another
+// movie in the batch failed validation.
+type batchResult struct {
+	Index  int               `json:"index"`
+	Status string            `json:"status"`
+	ID     int64             `json:"id,omitzero"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// The createMoviesBatchHandler creates the movies in a JSON array with a single
+// insert. By default the valid movies are created and the invalid ones reported,
+// while ?atomic=true rejects the whole batch if any movie is invalid.
+func (app *application) createMoviesBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var input []struct {
+		Title   string       `json:"title"`
+		Year    int32        `json:"year"`
+		Runtime data.Runtime `json:"runtime"`
+		Genres  []string     `json:"genres"`
+	}
+
+	v := validator.New()
+
+	atomic := app.readBool(r.URL.Query(), "atomic", false, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v.Check(len(input) >= 1, "movies", "must contain at least 1 movie")
+	v.Check(len(input) <= maxBatchSize, "movies", fmt.Sprintf("must not contain more than %d movies", maxBatchSize))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	genres, err := app.models.Genres.GetAll(r.Context())
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	results := make([]batchResult, len(input))
+
+	// Keep track of the valid movies and the index in the request body they came
+	// from, so that the generated ids can be reported at the right position.
+	movies := []*data.Movie{}
+	indexes := []int{}
+
+	for i, item := range input {
+		movie := &data.Movie{
+			Title:   item.Title,
+			Year:    item.Year,
+			Runtime: item.Runtime,
+			Genres:  item.Genres,
+		}
+
+		results[i].Index = i
+
+		v := validator.New()
+
+		if data.ValidateMovie(v, movie, genres); !v.Valid() {
+			results[i].Status = batchStatusInvalid
+			results[i].Errors = v.Errors
+			continue
+		}
+
+		movies = append(movies, movie)
+		indexes = append(indexes, i)
+	}
+
+	// In all-or-nothing mode a single invalid movie means nothing is inserted.
+	if atomic && len(movies) != len(input) {
+		for _, i := range indexes {
+			results[i].Status = batchStatusSkipped
+		}
+
+		app.writeBatchResults(w, r, http.StatusUnprocessableEntity, results, 0)
+		return
+	}
+
+	err = app.models.Movies.InsertBatch(r.Context(), movies, app.editor(r))
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for j, movie := range movies {
+		results[indexes[j]].Status = batchStatusCreated
+		results[indexes[j]].ID = movie.ID
+	}
+
+	// We respond with 201 Created as long as at least one movie was created. The
+	// per-item results tell the client which ones failed.
+	status := http.StatusCreated
+
+	if len(movies) == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	app.writeBatchResults(w, r, status, results, len(movies))
+}
+
+func (app *application) writeBatchResults(w http.ResponseWriter, r *http.Request, status int, results []batchResult, created int) {
+	e := envelope{
+		"created": created,
+		"failed":  len(results) - created,
+		"results": results,
+	}
+
+	err := app.writeJSON(w, status, e, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// The maximum number of entries a ttlCache holds. Keys can come from the query
+// string, so without a limit a client could fill the cache with unique keys.
+const maxCacheEntries = 1000
+
+// A ttlCache holds values for a fixed time after they are loaded. It is safe for
+// concurrent use, and the zero value is an empty cache ready to use. Concurrent
+// loads of the same key are collapsed into one, so a burst of requests for a
+// missing key only loads it once.
+type ttlCache[V any] struct {
+	mu      sync.Mutex
+	entries map[string]ttlCacheEntry[V]
+	loads   map[string]*ttlCacheLoad[V]
+}
+
+type ttlCacheEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// A ttlCacheLoad is a load in progress. The value and err are set before done is
+// closed.
+type ttlCacheLoad[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// getOrLoad returns the value stored under key if it hasn't expired yet. Otherwise
+// it calls load, or waits for a load of the same key which is already in progress,
+// and stores the value for ttl. A ttl of 0 disables caching, but concurrent loads
+// are still collapsed. Errors aren't cached.
+//
+// The load carries on if the request which started it is cancelled, since other
+// requests may be waiting for it, so it is given a context without cancellation.
+func (c *ttlCache[V]) getOrLoad(ctx context.Context, key string, ttl time.Duration, load func(context.Context) (V, error)) (V, error) {
+	c.mu.Lock()
+
+	if entry, ok := c.entries[key]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.value, nil
+	}
+
+	if l, ok := c.loads[key]; ok {
+		c.mu.Unlock()
+
+		select {
+		case <-l.done:
+			return l.value, l.err
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+
+	if c.loads == nil {
+		c.loads = map[string]*ttlCacheLoad[V]{}
+	}
+
+	l := &ttlCacheLoad[V]{done: make(chan struct{})}
+	c.loads[key] = l
+
+	c.mu.Unlock()
+
+	l.value, l.err = load(context.WithoutCancel(ctx))
+
+	c.mu.Lock()
+
+	delete(c.loads, key)
+
+	if l.err == nil && ttl > 0 {
+		c.set(key, l.value, ttl)
+	}
+
+	c.mu.Unlock()
+
+	close(l.done)
+
+	return l.value, l.err
+}
+
+// set stores a value under key for the given time. The caller must hold the lock.
+// When the cache is full the expired entries are removed, and if it is still full
+// the value isn't stored.
+func (c *ttlCache[V]) set(key string, value V, ttl time.Duration) {
+	now := time.Now()
+
+	if c.entries == nil {
+		c.entries = map[string]ttlCacheEntry[V]{}
+	}
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCacheEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+
+		if len(c.entries) >= maxCacheEntries {
+			return
+		}
+	}
+
+	c.entries[key] = ttlCacheEntry[V]{value: value, expires: now.Add(ttl)}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTTLCacheCollapsesConcurrentLoads(t *testing.T) {
+	var c ttlCache[int]
+	var loads atomic.Int32
+
+	release := make(chan struct{})
+
+	load := func(ctx context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Go(func() {
+			v, err := c.getOrLoad(context.Background(), "key", time.Minute, load)
+
+			if err != nil || v != 42 {
+				t.Errorf("got %d, %v; want 42, nil", v, err)
+			}
+		})
+	}
+
+	// Give the goroutines time to queue up behind the first load.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("got %d loads; want 1", n)
+	}
+
+	// The value is now cached.
+	v, err := c.getOrLoad(context.Background(), "key", time.Minute, func(ctx context.Context) (int, error) {
+		return 0, errors.New("loaded again")
+	})
+
+	if err != nil || v != 42 {
+		t.Errorf("got %d, %v; want the cached 42", v, err)
+	}
+}
+
+func TestTTLCacheDoesNotCacheErrorsOrZeroTTL(t *testing.T) {
+	var c ttlCache[int]
+
+	_, err := c.getOrLoad(context.Background(), "key", time.Minute, func(ctx context.Context) (int, error) {
+		return 0, errors.New("boom")
+	})
+
+	if err == nil {
+		t.Fatal("got no error; want the load error")
+	}
+
+	c.getOrLoad(context.Background(), "other", 0, func(ctx context.Context) (int, error) {
+		return 1, nil
+	})
+
+	if len(c.entries) != 0 {
+		t.Errorf("got %d entries; want 0", len(c.entries))
+	}
+}
+
+func TestTTLCacheIsBounded(t *testing.T) {
+	var c ttlCache[int]
+
+	for i := range maxCacheEntries + 10 {
+		c.getOrLoad(context.Background(), fmt.Sprint(i), time.Minute, func(ctx context.Context) (int, error) {
+			return i, nil
+		})
+	}
+
+	if len(c.entries) != maxCacheEntries {
+		t.Errorf("got %d entries; want %d", len(c.entries), maxCacheEntries)
+	}
+}
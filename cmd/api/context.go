@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+)
+
+// Define a custom contextKey type, with the underlying type string. Using our own
+// type for the keys avoids collisions with context values set by other packages.
+type contextKey string
+
+const (
+	userContextKey  = contextKey("user")
+	routeContextKey = contextKey("route")
+)
+
+// The contextSetUser() method returns a new copy of the request with the provided
+// User struct added to the context.
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// The contextGetUser() retrieves the User struct from the request context. The only
+// time that we'll use this helper is when we logically expect there to be a User
+// struct value in the context, and if it doesn't exist it will firmly be an
+// 'unexpected' error so we panic.
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
+
+// The contextSetRequestID() method returns a new copy of the request with the
+// provided request ID added to the context. The ID is stored by the data package,
+// so that queries run with the request's context are tagged with it.
+func (app *application) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := data.ContextWithRequestID(r.Context(), requestID)
+	return r.WithContext(ctx)
+}
+
+// The contextGetRequestID() retrieves the request ID from the request context. An
+// empty string is returned if the request didn't pass through the requestID
+// middleware.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	return data.RequestIDFromContext(r.Context())
+}
+
+// The contextSetLogger() method returns a new copy of the request with the provided
+// request-scoped logger added to the context. The logger is stored by the data
+// package, so that errors logged by the models carry the same attributes.
+func (app *application) contextSetLogger(r *http.Request, logger *slog.Logger) *http.Request {
+	ctx := data.ContextWithLogger(r.Context(), logger)
+	return r.WithContext(ctx)
+}
+
+// The contextGetLogger() retrieves the request-scoped logger from the request
+// context, which carries the request ID, method, URI and client IP of the request.
+// The default logger, which main() sets to the application logger, is returned if
+// the request didn't pass through the logRequest middleware.
+func (app *application) contextGetLogger(r *http.Request) *slog.Logger {
+	return data.LoggerFromContext(r.Context())
+}
+
+// The contextSetRoute() method returns a new copy of the request with room in the
+// context for the route which matches it, unless it already has it. The router
+// fills it in, so that middleware running outside the router can read it back with
+// contextGetRoute() once the request has been handled.
+func (app *application) contextSetRoute(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(routeContextKey).(*string); ok {
+		return r
+	}
+
+	ctx := context.WithValue(r.Context(), routeContextKey, new(string))
+	return r.WithContext(ctx)
+}
+
+// The contextSaveRoute() method records the pattern of the route which matched the
+// request, like "/v1/movies/:id/reviews". It does nothing if the request didn't
+// pass through contextSetRoute().
+func (app *application) contextSaveRoute(r *http.Request, pattern string) {
+	if route, ok := r.Context().Value(routeContextKey).(*string); ok {
+		*route = pattern
+	}
+}
+
+// The contextGetRoute() retrieves the pattern of the route which matched the
+// request. An empty string is returned if no route matched.
+func (app *application) contextGetRoute(r *http.Request) string {
+	route, ok := r.Context().Value(routeContextKey).(*string)
+
+	if !ok {
+		return ""
+	}
+
+	return *route
+}
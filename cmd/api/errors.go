@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
 )
 
-// the logError() method is a generic helper for logging an error message along
-// with the current request method and URL as attributes in the log entry.
-func (app *application) logError(r *http.Request, err error) {
-	method := r.Method
-	uri := r.URL.RequestURI()
+// The status code sent when the client closes the connection before the request
+// has been handled. It isn't a standard status code, so net/http has no name for it.
+const statusClientClosedRequest = 499
 
-	app.logger.Error(err.Error(), "method", method, "uri", uri)
+// the logError() method is a generic helper for logging an error message with the
+// request-scoped logger, so the log entry carries the same request ID, method, URI
+// and client IP attributes as the request's own log entry.
+func (app *application) logError(r *http.Request, err error) {
+	app.contextGetLogger(r).Error(err.Error())
 }
 
 // The errorResponse method is a generic helper for sending json formatted error
@@ -30,13 +36,53 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 }
 
 // The serverErrorRespons method will be used when our application encounters an
-// unexpected prbolem at runtime. It logs the details error message, then uses the
-// errorResponse helper to send a 500 status code and json response to the client.
+// unexpected prbolem at runtime. It logs the details error message, then sends a
+// 500 status code and json response to the client. The response includes the
+// request ID, so that a client reporting the problem can point us at the log entry.
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	// Errors caused by the request being canceled or taking too long aren't bugs,
+	// so they get their own responses and are logged at a lower level. A query
+	// canceled by the database's own statement_timeout counts as taking too long.
+	switch {
+	case errors.Is(err, context.Canceled):
+		app.clientClosedRequestResponse(w, r, err)
+		return
+	case errors.Is(err, context.DeadlineExceeded), data.IsQueryCanceled(err):
+		app.timeoutResponse(w, r, err)
+		return
+	}
+
 	app.logError(r, err)
 
 	message := "The server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+
+	err = app.writeJSON(w, http.StatusInternalServerError, envelope{"error": message, "request_id": app.contextGetRequestID(r)}, nil)
+
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
+// The clientClosedRequestResponse will be used when the client goes away before
+// the request has been handled, which cancels its context. Nobody is left to read
+// the response, but the 499 status code (borrowed from nginx) makes these requests
+// easy to tell apart in the request log.
+func (app *application) clientClosedRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.contextGetLogger(r).Info("request canceled by the client", "error", err.Error())
+
+	message := "The client closed the request before it was processed"
+	app.errorResponse(w, r, statusClientClosedRequest, message)
+}
+
+// The timeoutResponse will be used to send 503 status codes and json responses to
+// the client when a query runs out of time, which usually means that the database
+// is overloaded and the request is worth retrying later.
+func (app *application) timeoutResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.contextGetLogger(r).Warn(err.Error())
+
+	message := "The server took too long to process your request, please try again later"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
 }
 
 // The notFoundResponse will be used to send 404 status codes and json responses
@@ -70,3 +116,46 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 		"unable to update the record due to an edit conflict, please try again",
 	)
 }
+
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The invalidAuthenticationTokenResponse includes a WWW-Authenticate header to
+// remind the client that we expect a bearer token.
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// the idempotencyKeyMismatchResponse will be used when an Idempotency-Key is reused
+// with a different request.
+func (app *application) idempotencyKeyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the Idempotency-Key has already been used for a different request"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+// the idempotencyKeyInUseResponse will be used when a request is retried while the
+// original request with the same Idempotency-Key is still being processed.
+func (app *application) idempotencyKeyInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with this Idempotency-Key is still being processed, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) genreInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the genre is still used by one or more movies and cannot be deleted"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
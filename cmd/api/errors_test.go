@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestServerErrorResponse(t *testing.T) {
+	canceled := &pq.Error{Code: "57014", Message: "canceling statement due to user request"}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"client went away", fmt.Errorf("%w: %w", context.Canceled, canceled), statusClientClosedRequest},
+		{"query ran out of time", fmt.Errorf("%w: %w", context.DeadlineExceeded, canceled), http.StatusServiceUnavailable},
+		{"statement timeout", fmt.Errorf("reading rows: %w", &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"}), http.StatusServiceUnavailable},
+		{"other database error", &pq.Error{Code: "23505", Message: "duplicate key"}, http.StatusInternalServerError},
+		{"other error", errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				app.serverErrorResponse(w, r, tt.err)
+			})
+
+			rr := send(t, app.requestID(next), http.MethodGet, "/", "", nil)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.wantStatus)
+			}
+
+			e := decodeEnvelope(t, rr)
+
+			// Only unexpected errors point the client at the log entry.
+			if _, ok := e["request_id"]; ok != (tt.wantStatus == http.StatusInternalServerError) {
+				t.Errorf("got envelope %v; want request_id only for a 500", e)
+			}
+		})
+	}
+}
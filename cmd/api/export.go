@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// The separator used to flatten the genres of a movie into a single CSV field.
+const csvGenreSeparator = "|"
+
+// The columns of the CSV export, in order.
+var csvHeader = []string{"id", "created_at", "title", "year", "runtime", "genres", "version"}
+
+// The exportMoviesHandler streams every movie matching the same title, genres,
+// country and sort parameters as listMoviesHandler as either CSV or NDJSON (one
+// JSON object per line). The response isn't paginated. Titles aren't translated.
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+		Format  string
+		Title   string
+		Genres  []string
+		Country string
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Format = app.readString(qs, "format", "csv")
+	input.Title = app.readString(qs, "title", "")
+	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.Country = strings.ToUpper(app.readString(qs, "country", ""))
+	input.Sort = app.readString(qs, "sort", "title")
+	input.SortSafeList = []string{"title", "genres", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+
+	v.Check(validator.PermittedValue(input.Format, "csv", "ndjson"), "format", "must be csv or ndjson")
+	v.Check(validator.PermittedValue(input.Sort, input.SortSafeList...), "sort", "invalid sort value")
+
+	if input.Country != "" {
+		v.Check(validator.Matches(input.Country, data.CountryRX), "country", "must be a two letter country code like GB")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// An export of the whole catalogue can take longer than the server's write
+	// timeout, so we extend the deadline for this response to match the export query.
+	// Writers which don't support deadlines (like httptest.ResponseRecorder) have
+	// no timeout to extend.
+	rc := http.NewResponseController(w)
+
+	err := rc.SetWriteDeadline(time.Now().Add(5 * time.Minute))
+
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var write func(*data.Movie) error
+	var flush func() error
+
+	switch input.Format {
+	case "csv":
+		cw := csv.NewWriter(w)
+
+		// The header row is buffered by the csv.Writer, so nothing is sent until the
+		// first flush.
+		err = cw.Write(csvHeader)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.csv"`)
+
+		write = func(movie *data.Movie) error {
+			return cw.Write([]string{
+				strconv.FormatInt(movie.ID, 10),
+				movie.CreatedAt.Format(time.RFC3339),
+				movie.Title,
+				strconv.Itoa(int(movie.Year)),
+				movie.Runtime.String(),
+				strings.Join(movie.Genres, csvGenreSeparator),
+				strconv.Itoa(int(movie.Version)),
+			})
+		}
+
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.ndjson"`)
+
+		write = func(movie *data.Movie) error {
+			return encoder.Encode(movie)
+		}
+		flush = func() error { return nil }
+	}
+
+	// Flush the response to the client after every batch of movies, so that the
+	// export is sent as it is read rather than buffered in memory.
+	count := 0
+
+	err = app.models.Movies.Export(r.Context(), input.Title, input.Genres, input.Country, input.Filters, func(movie *data.Movie) error {
+		err := write(movie)
+
+		if err != nil {
+			return err
+		}
+
+		count++
+
+		if count%100 == 0 {
+			err = flush()
+
+			if err != nil {
+				return err
+			}
+
+			return rc.Flush()
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		err = flush()
+	}
+
+	if err != nil {
+		// If no movies have been written yet we can still send an error response.
+		// Otherwise the client will receive a truncated export, and all we can do is
+		// log it.
+		if count == 0 {
+			w.Header().Del("Content-Disposition")
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = fmt.Errorf("export aborted after %d movies: %w", count, err)
+
+		// A client which disconnects part way through isn't an error on our side.
+		if errors.Is(err, context.Canceled) {
+			app.contextGetLogger(r).Info(err.Error())
+			return
+		}
+
+		app.logError(r, err)
+	}
+}
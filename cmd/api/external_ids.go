@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// The lookupMovieHandler finds a movie by its id in another catalogue, like
+// /v1/movies/lookup?source=imdb&id=tt0111161.
+func (app *application) lookupMovieHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Source string
+		ID     string
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Source = app.readString(qs, "source", "")
+	input.ID = app.readString(qs, "id", "")
+
+	v.Check(input.Source != "", "source", "must be provided")
+	v.Check(input.ID != "", "id", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if data.ValidateExternalID(v, "id", input.Source, input.ID); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movieID, err := app.models.ExternalIDs.GetMovieID(r.Context(), input.Source, input.ID)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	movie, err := app.models.Movies.Get(r.Context(), movieID)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The putMovieExternalIDHandler maps an id from the source in the URL to a movie,
+// replacing the movie's existing id from that source.
+func (app *application) putMovieExternalIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		ID string `json:"id"`
+	}
+
+	err = app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	source := httprouter.ParamsFromContext(r.Context()).ByName("source")
+
+	v := validator.New()
+
+	if data.ValidateExternalID(v, "id", source, input.ID); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.ExternalIDs.Set(r.Context(), id, source, input.ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("id", "is already mapped to another movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"external_id": envelope{"source": source, "id": input.ID}}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMovieExternalIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	source := httprouter.ParamsFromContext(r.Context()).ByName("source")
+
+	err = app.models.ExternalIDs.Delete(r.Context(), id, source)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusNoContent, nil, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,17 +1,21 @@
 package main
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"maps"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
 	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
 )
 
@@ -32,6 +36,63 @@ func (app *application) readIdParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// The readVersionParam() helper reads the "version" URL parameter in the same way
+// readIdParam() reads the "id" parameter.
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	version, err := strconv.ParseInt(params.ByName("version"), 10, 32)
+
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+
+	return int32(version), nil
+}
+
+// The readMovieIdParam() helper reads the "movie_id" URL parameter of nested routes
+// like /v1/lists/:id/items/:movie_id.
+func (app *application) readMovieIdParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("movie_id"), 10, 64)
+
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid movie_id parameter")
+	}
+
+	return id, nil
+}
+
+// The requireMovie() helper checks that the movie with the given id exists and
+// sends a not found response if it doesn't, returning false. Handlers of the
+// sub-resources of a movie use it to tell a missing movie apart from a movie
+// without any of them.
+func (app *application) requireMovie(w http.ResponseWriter, r *http.Request, id int64) bool {
+	exists, err := app.models.Movies.Exists(r.Context(), id)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !exists {
+		app.notFoundResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// The editor() helper returns the data.Editor which is recorded in the revision
+// history of any movie changed by the request.
+func (app *application) editor(r *http.Request) data.Editor {
+	return data.Editor{
+		UserID:    app.contextGetUser(r).ID,
+		RequestID: app.contextGetRequestID(r),
+	}
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	js, err := json.MarshalIndent(data, "", "\t")
 	// js, err := json.Marshal(data)
@@ -160,3 +221,112 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 
 	return i
 }
+
+// The readBool() helper reads a string value from the query string and converts it
+// into a bool. Like readInt() it adds a validation error to the validator instance
+// and returns the default value if the conversion fails.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// The maximum number of locales read from the Accept-Language header.
+const maxLocales = 10
+
+// The readLocales() helper parses the Accept-Language header into a list of
+// lowercase locales in order of preference, like ["pt-br", "pt", "en"]. The base
+// language of each regional locale is added after it as a fallback. Wildcards,
+// locales with a quality of 0 and malformed values are skipped.
+func (app *application) readLocales(r *http.Request) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+
+	var ranges []weighted
+
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		locale, params, _ := strings.Cut(part, ";")
+		locale = data.NormalizeLocale(locale)
+
+		if !data.LocaleRX.MatchString(locale) {
+			continue
+		}
+
+		q := 1.0
+
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+
+			if err != nil {
+				continue
+			}
+
+			q = parsed
+		}
+
+		if q > 0 {
+			ranges = append(ranges, weighted{locale: locale, q: q})
+		}
+	}
+
+	// Sort by quality, keeping the order of the header for equal qualities.
+	slices.SortStableFunc(ranges, func(a, b weighted) int {
+		return cmp.Compare(b.q, a.q)
+	})
+
+	locales := []string{}
+
+	for _, rng := range ranges {
+		base, _, _ := strings.Cut(rng.locale, "-")
+
+		for _, locale := range []string{rng.locale, base} {
+			if len(locales) < maxLocales && !slices.Contains(locales, locale) {
+				locales = append(locales, locale)
+			}
+		}
+	}
+
+	return locales
+}
+
+// The readFilePart() helper streams the multipart request body and returns the
+// part for the given form field. Unlike ParseMultipartForm() this doesn't read the
+// file into memory or a temporary file.
+func (app *application) readFilePart(r *http.Request, field string) (*multipart.Part, error) {
+	reader, err := r.MultipartReader()
+
+	if err != nil {
+		return nil, errors.New("body must be a multipart/form-data upload")
+	}
+
+	for {
+		part, err := reader.NextPart()
+
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("body must contain a %q field", field)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == field {
+			return part, nil
+		}
+
+		part.Close()
+	}
+}
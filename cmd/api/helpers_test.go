@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestReadJSON(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"valid", `{"title": "Moon", "year": 2009}`, ""},
+		{"badly-formed", `{"title": "Moon",}`, "body contains badly-formed JSON (at character 18)"},
+		{"unexpected EOF", `{"title": "Moon"`, "body contains badly-formed JSON"},
+		{"wrong type for field", `{"title": 2009}`, `body contains incorrect JSON type for field "title"`},
+		{"wrong type", `["Moon"]`, "body contains incorrect JSON type (at character 1)"},
+		{"empty", ``, "body must not be empty"},
+		{"unknown field", `{"rating": 8}`, `json: unknown field "rating"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+
+			var input struct {
+				Title string `json:"title"`
+				Year  int32  `json:"year"`
+			}
+
+			err := app.readJSON(r, &input)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("got error %q; want none", err)
+				}
+
+				return
+			}
+
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v; want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadJSONInvalidDestination(t *testing.T) {
+	app := newTestApplication(t)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("readJSON didn't panic for a non-pointer destination")
+		}
+	}()
+
+	var input struct{}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+
+	app.readJSON(r, input)
+}
+
+func TestReadIdParam(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name    string
+		id      string
+		want    int64
+		wantErr bool
+	}{
+		{"valid", "1", 1, false},
+		{"largest", "9223372036854775807", 9223372036854775807, false},
+		{"zero", "0", 0, true},
+		{"negative", "-1", 0, true},
+		{"not a number", "abc", 0, true},
+		{"decimal", "1.5", 0, true},
+		{"overflow", "9223372036854775808", 0, true},
+		{"empty", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			params := httprouter.Params{{Key: "id", Value: tt.id}}
+			r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+
+			id, err := app.readIdParam(r)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+
+			if id != tt.want {
+				t.Errorf("got id %d; want %d", id, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadLocales(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name   string
+		header string
+		want   []string
+	}{
+		{"missing", "", []string{}},
+		{"single", "fr", []string{"fr"}},
+		{"regional falls back to base", "pt-BR", []string{"pt-br", "pt"}},
+		{"underscores", "pt_BR", []string{"pt-br", "pt"}},
+		{"sorted by quality", "en;q=0.5, de, fr;q=0.8", []string{"de", "fr", "en"}},
+		{"equal qualities keep header order", "fr;q=0.5, de;q=0.5", []string{"fr", "de"}},
+		{"base not repeated", "en-GB, en-US, en", []string{"en-gb", "en", "en-us"}},
+		{"zero quality skipped", "fr;q=0, de", []string{"de"}},
+		{"wildcard and malformed skipped", "*, 12, de;q=abc, it", []string{"it"}},
+		{"capped", "aa, bb, cc, dd, ee, ff, gg, hh, ii, jj, kk", []string{"aa", "bb", "cc", "dd", "ee", "ff", "gg", "hh", "ii", "jj"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Language", tt.header)
+
+			got := app.readLocales(r)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
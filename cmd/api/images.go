@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/storage"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+const (
+	// The maximum size of an uploaded image file.
+	maxImageBytes = 10 << 20
+
+	// The maximum number of pixels in an uploaded image. Images are decoded into
+	// memory and then copied once into a 4 byte per pixel RGBA image, so this stops
+	// a small, highly compressed file from using gigabytes.
+	maxImagePixels = 25_000_000
+
+	// The quality the resized images are encoded with.
+	imageJPEGQuality = 85
+)
+
+// The content types accepted for uploaded images, as reported by
+// http.DetectContentType().
+var imageContentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// An imageSize is one of the resized versions generated for an uploaded image.
+// Images are scaled down to the width, keeping their aspect ratio, and are never
+// scaled up.
+type imageSize struct {
+	name  string
+	width int
+}
+
+// The sizes generated for each kind of image. The uploaded file is also kept
+// unchanged as the "original" size.
+var imageSizes = map[string][]imageSize{
+	data.ImagePoster: {
+		{name: "small", width: 185},
+		{name: "medium", width: 342},
+		{name: "large", width: 780},
+	},
+	data.ImageBackdrop: {
+		{name: "small", width: 300},
+		{name: "medium", width: 780},
+		{name: "large", width: 1280},
+	},
+}
+
+func (app *application) uploadMoviePosterHandler(w http.ResponseWriter, r *http.Request) {
+	app.uploadMovieImage(w, r, data.ImagePoster)
+}
+
+func (app *application) uploadMovieBackdropHandler(w http.ResponseWriter, r *http.Request) {
+	app.uploadMovieImage(w, r, data.ImageBackdrop)
+}
+
+// The uploadMovieImage() method reads the "image" part of a multipart upload,
+// checks that it is a JPEG, PNG or GIF image by sniffing its contents, and stores
+// it along with its resized versions. Any previous image of the same kind is
+// replaced and its files are removed.
+func (app *application) uploadMovieImage(w http.ResponseWriter, r *http.Request, kind string) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.requireMovie(w, r, id) {
+		return
+	}
+
+	// An upload over a slow connection can take longer than the server's read
+	// timeout, so we extend the deadline for this request.
+	err = http.NewResponseController(w).SetReadDeadline(time.Now().Add(time.Minute))
+
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Allow some room for the multipart headers on top of the image itself.
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageBytes+1<<20)
+
+	part, err := app.readFilePart(r, "image")
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	defer part.Close()
+
+	// Read one byte more than the limit, so that we can tell a file which is
+	// exactly the maximum size apart from one which is too large.
+	content, err := io.ReadAll(io.LimitReader(part, maxImageBytes+1))
+
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(content) > 0, "image", "must be provided")
+	v.Check(len(content) <= maxImageBytes, "image", "must not be larger than 10MB")
+	v.Check(validator.PermittedValue(http.DetectContentType(content), imageContentTypes...), "image", "must be a JPEG, PNG or GIF image")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Check the dimensions from the image header before decoding the whole image.
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+
+	if err != nil {
+		v.AddError("image", "could not be decoded")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The width and height are checked separately first, so that their product
+	// can't overflow.
+	v.Check(config.Width <= maxImagePixels && config.Height <= maxImagePixels && config.Width*config.Height <= maxImagePixels, "image", fmt.Sprintf("must not have more than %d megapixels", maxImagePixels/1_000_000))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+
+	if err != nil {
+		v.AddError("image", "could not be decoded")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stored, err := app.storeMovieImage(r.Context(), id, kind, content, img)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	old, err := app.models.Movies.SetImage(r.Context(), id, kind, stored)
+
+	if err != nil {
+		app.deleteMovieImage(stored)
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	app.deleteMovieImage(old)
+
+	movie, err := app.models.Movies.Get(r.Context(), id)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The storeMovieImage() helper stores the original image and each of its resized
+// versions. Every upload gets a new random key, so the URLs of an image never
+// change and can be cached indefinitely.
+func (app *application) storeMovieImage(ctx context.Context, movieID int64, kind string, original []byte, img image.Image) (data.Image, error) {
+	stored := data.Image{
+		Key:  fmt.Sprintf("movies/%d/%s/%s", movieID, kind, strings.ToLower(rand.Text())),
+		URLs: data.ImageURLs{},
+	}
+
+	put := func(size string, r io.Reader) error {
+		key := stored.Key + "/" + size
+
+		err := app.storage.Put(ctx, key, r)
+
+		if err != nil {
+			return err
+		}
+
+		stored.URLs[size] = app.storage.URL(key)
+
+		return nil
+	}
+
+	err := put("original", bytes.NewReader(original))
+
+	if err != nil {
+		app.deleteMovieImage(stored)
+		return data.Image{}, err
+	}
+
+	// The image is flattened once and each size is resized from the same copy.
+	flat := flattenImage(img)
+
+	var buf bytes.Buffer
+
+	for _, size := range imageSizes[kind] {
+		buf.Reset()
+
+		err := jpeg.Encode(&buf, resizeImage(flat, size.width), &jpeg.Options{Quality: imageJPEGQuality})
+
+		if err == nil {
+			err = put(size.name, &buf)
+		}
+
+		if err != nil {
+			app.deleteMovieImage(stored)
+			return data.Image{}, err
+		}
+	}
+
+	return stored, nil
+}
+
+// The deleteMovieImage() helper removes the stored files of an image. The image has
+// already been replaced or was never saved, so failures are logged rather than
+// returned.
+func (app *application) deleteMovieImage(img data.Image) {
+	if img.Key == "" {
+		return
+	}
+
+	for size := range img.URLs {
+		err := app.storage.Delete(context.Background(), img.Key+"/"+size)
+
+		if err != nil {
+			app.logger.Error(err.Error(), "key", img.Key+"/"+size)
+		}
+	}
+}
+
+// flattenImage draws an image onto a white RGBA image, so that resizeImage() can
+// read its pixels directly whatever the format of the source. Transparent areas
+// are flattened onto white, since the resized images are encoded as JPEGs.
+func flattenImage(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, bounds.Min, draw.Over)
+
+	return flat
+}
+
+// resizeImage scales a flattened image down to the given width, keeping its
+// aspect ratio. Each pixel of the result is the average of the block of source
+// pixels it covers, which avoids the aliasing of nearest-neighbour scaling.
+func resizeImage(flat *image.RGBA, width int) image.Image {
+	srcWidth, srcHeight := flat.Bounds().Dx(), flat.Bounds().Dy()
+
+	if width >= srcWidth {
+		return flat
+	}
+
+	height := max(1, srcHeight*width/srcWidth)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		y0 := y * srcHeight / height
+		y1 := max(y0+1, (y+1)*srcHeight/height)
+
+		for x := range width {
+			x0 := x * srcWidth / width
+			x1 := max(x0+1, (x+1)*srcWidth/width)
+
+			var sum [4]int
+			n := 0
+
+			for sy := y0; sy < y1; sy++ {
+				row := flat.Pix[sy*flat.Stride:]
+
+				for sx := x0; sx < x1; sx++ {
+					for c := range sum {
+						sum[c] += int(row[sx*4+c])
+					}
+
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+
+			for c := range sum {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+
+	return dst
+}
+
+// The serveImageHandler serves the images kept by local storage. Other storage
+// backends serve their files themselves, so this returns a 404 for them.
+func (app *application) serveImageHandler(w http.ResponseWriter, r *http.Request) {
+	local, ok := app.storage.(*storage.Local)
+
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	key := strings.TrimPrefix(httprouter.ParamsFromContext(r.Context()).ByName("filepath"), "/")
+
+	f, err := local.Open(key)
+
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Every upload is stored under a new key, so a stored file never changes.
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// The keys have no file extension, so ServeContent() sets the Content-Type by
+	// sniffing the file.
+	http.ServeContent(w, r, key, info.ModTime(), f)
+}
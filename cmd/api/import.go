@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+const (
+	// The maximum size of an uploaded import file.
+	maxImportBytes = 100 << 20
+
+	// The maximum number of row errors included in the import report. Rows beyond
+	// this are still counted, but their errors aren't kept in memory.
+	maxImportRowErrors = 1000
+)
+
+// An importRowError reports the problems found with a single row of an import file.
+// Rows are numbered from 1, and for a CSV file the header is row 1.
+type importRowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+// An importReport summarises an import. When the import is a dry run nothing is
+// inserted, so Imported is always 0.
+type importReport struct {
+	DryRun    bool             `json:"dry_run"`
+	TotalRows int              `json:"total_rows"`
+	ValidRows int              `json:"valid_rows"`
+	Imported  int              `json:"imported"`
+	Errors    []importRowError `json:"errors"`
+}
+
+// A movieRowReader reads the movies from an import file one row at a time. The
+// rowErrors describe any fields which couldn't be parsed, and the movie is nil if
+// the row couldn't be parsed at all. io.EOF is returned once the file has been read.
+type movieRowReader interface {
+	next() (row int, movie *data.Movie, rowErrors map[string]string, err error)
+}
+
+// The importMoviesHandler reads movies from the "file" part of a multipart CSV or
+// NDJSON upload. Each row is validated with ValidateMovie() and the valid rows are
+// imported in a single transaction once the whole file has been read, unless
+// ?dry_run=true in which case only the report of row errors is returned.
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	dryRun := app.readBool(qs, "dry_run", false, v)
+	format := app.readString(qs, "format", "")
+
+	v.Check(format == "" || validator.PermittedValue(format, "csv", "ndjson"), "format", "must be csv or ndjson")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// A large upload can take longer than the server's read timeout, so we extend
+	// the deadline for this request.
+	err := http.NewResponseController(w).SetReadDeadline(time.Now().Add(5 * time.Minute))
+
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	part, err := app.readFilePart(r, "file")
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	defer part.Close()
+
+	// If the format wasn't given in the query string, we work it out from the
+	// extension of the uploaded file.
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(part.FileName())) {
+		case ".csv":
+			format = "csv"
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		default:
+			v.AddError("format", "must be provided when the file extension isn't .csv or .ndjson")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	var rows movieRowReader
+
+	switch format {
+	case "csv":
+		rows, err = newCSVMovieReader(part)
+
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	case "ndjson":
+		rows = newNDJSONMovieReader(part)
+	}
+
+	genres, err := app.models.Genres.GetAll(r.Context())
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	report := importReport{
+		DryRun: dryRun,
+		Errors: []importRowError{},
+	}
+
+	// Read and validate the whole file before importing anything, so that the
+	// transaction isn't held open while a slow client uploads it. The invalid rows
+	// are added to the report, and the valid ones are kept to be imported.
+	movies := []*data.Movie{}
+
+	for {
+		row, movie, rowErrors, err := rows.next()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+
+			if errors.As(err, &maxBytesError) {
+				app.badRequestResponse(w, r, fmt.Errorf("file must not be larger than %d bytes", maxBytesError.Limit))
+			} else {
+				app.badRequestResponse(w, r, err)
+			}
+
+			return
+		}
+
+		report.TotalRows++
+
+		// Validate whatever could be parsed. A parse error takes precedence over the
+		// validation error for the same field, since AddError() keeps the first one.
+		if movie != nil {
+			v := validator.New()
+
+			for key, message := range rowErrors {
+				v.AddError(key, message)
+			}
+
+			data.ValidateMovie(v, movie, genres)
+			rowErrors = v.Errors
+		}
+
+		if len(rowErrors) > 0 {
+			if len(report.Errors) < maxImportRowErrors {
+				report.Errors = append(report.Errors, importRowError{Row: row, Errors: rowErrors})
+			}
+
+			continue
+		}
+
+		report.ValidRows++
+
+		if !dryRun {
+			movies = append(movies, movie)
+		}
+	}
+
+	// The movies are imported in a single transaction, so if the database fails part
+	// way through nothing is imported.
+	if !dryRun {
+		err = app.models.Movies.Import(r.Context(), movies, app.editor(r))
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		report.Imported = len(movies)
+	}
+
+	status := http.StatusOK
+
+	if !dryRun {
+		status = http.StatusCreated
+
+		if report.Imported == 0 {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+
+	err = app.writeJSON(w, status, envelope{"report": report}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The columns which must be present in the header row of a CSV import. Any other
+// columns (like the id and version included in an export) are ignored.
+var csvImportColumns = []string{"title", "year", "runtime", "genres"}
+
+type csvMovieReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVMovieReader(r io.Reader) (*csvMovieReader, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("file must not be empty")
+		}
+
+		return nil, fmt.Errorf("file contains an invalid CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range csvImportColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("file is missing the %q column", name)
+		}
+	}
+
+	return &csvMovieReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvMovieReader) next() (int, *data.Movie, map[string]string, error) {
+	record, err := c.reader.Read()
+
+	if errors.Is(err, io.EOF) {
+		return 0, nil, nil, io.EOF
+	}
+
+	// A csv.ParseError only affects the current row, so we report it against the
+	// row and carry on reading. Any other error means the upload itself failed.
+	var parseError *csv.ParseError
+
+	if errors.As(err, &parseError) {
+		return parseError.StartLine, nil, map[string]string{"row": parseError.Err.Error()}, nil
+	}
+
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	row, _ := c.reader.FieldPos(0)
+
+	rowErrors := map[string]string{}
+	movie := &data.Movie{
+		Title: record[c.columns["title"]],
+	}
+
+	year, err := strconv.ParseInt(strings.TrimSpace(record[c.columns["year"]]), 10, 32)
+
+	if err != nil {
+		rowErrors["year"] = "must be an integer value"
+	}
+
+	movie.Year = int32(year)
+
+	movie.Runtime, err = data.ParseRuntime(strings.TrimSpace(record[c.columns["runtime"]]))
+
+	if err != nil {
+		rowErrors["runtime"] = `must be in the format "<runtime> mins"`
+	}
+
+	// Genres are flattened into a single field in the same way as the CSV export.
+	if genres := record[c.columns["genres"]]; genres != "" {
+		movie.Genres = strings.Split(genres, csvGenreSeparator)
+	}
+
+	return row, movie, rowErrors, nil
+}
+
+type ndjsonMovieReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONMovieReader(r io.Reader) *ndjsonMovieReader {
+	scanner := bufio.NewScanner(r)
+
+	// Allow lines of up to 1MB, rather than the 64KB default.
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	return &ndjsonMovieReader{scanner: scanner}
+}
+
+func (n *ndjsonMovieReader) next() (int, *data.Movie, map[string]string, error) {
+	for n.scanner.Scan() {
+		n.line++
+
+		line := n.scanner.Bytes()
+
+		// Blank lines (like a trailing newline) aren't rows.
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		// Fields other than these (like the id and version included in an export)
+		// are ignored.
+		var input struct {
+			Title   string       `json:"title"`
+			Year    int32        `json:"year"`
+			Runtime data.Runtime `json:"runtime"`
+			Genres  []string     `json:"genres"`
+		}
+
+		err := json.Unmarshal(line, &input)
+
+		if err != nil {
+			var unmarshalTypeError *json.UnmarshalTypeError
+
+			switch {
+			case errors.Is(err, data.ErrInvalidRuntimeFormat):
+				return n.line, nil, map[string]string{"runtime": `must be in the format "<runtime> mins"`}, nil
+			case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+				return n.line, nil, map[string]string{unmarshalTypeError.Field: "incorrect JSON type"}, nil
+			default:
+				return n.line, nil, map[string]string{"row": "contains badly-formed JSON"}, nil
+			}
+		}
+
+		movie := &data.Movie{
+			Title:   input.Title,
+			Year:    input.Year,
+			Runtime: input.Runtime,
+			Genres:  input.Genres,
+		}
+
+		return n.line, movie, nil, nil
+	}
+
+	if err := n.scanner.Err(); err != nil {
+		return 0, nil, nil, err
+	}
+
+	return 0, nil, nil, io.EOF
+}
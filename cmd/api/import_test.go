@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+)
+
+// multipartFile returns a multipart/form-data body with content as the "file"
+// part, along with the header to send it with.
+func multipartFile(t *testing.T, filename string, content string) (string, http.Header) {
+	t.Helper()
+
+	var body bytes.Buffer
+
+	mw := multipart.NewWriter(&body)
+
+	fw, err := mw.CreateFormFile("file", filename)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fw.Write([]byte(content))
+
+	err = mw.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return body.String(), http.Header{"Content-Type": {mw.FormDataContentType()}}
+}
+
+func TestImportMovies(t *testing.T) {
+	const csvFile = "title,year,runtime,genres\n" +
+		"Moon,2009,97 mins,drama|sci-fi\n" +
+		"Alien,1979,117 mins,sci-fi\n" +
+		",1979,nope,western\n"
+
+	const ndjsonFile = `{"title": "Heat", "year": 1995, "runtime": "170 mins", "genres": ["action", "drama"]}` + "\n"
+
+	tests := []struct {
+		name         string
+		target       string
+		filename     string
+		content      string
+		wantStatus   int
+		wantImported float64
+		wantErrors   int
+		wantMovies   int
+	}{
+		{"csv", "/v1/movies/import", "movies.csv", csvFile, http.StatusCreated, 2, 1, 2},
+		{"dry run", "/v1/movies/import?dry_run=true", "movies.csv", csvFile, http.StatusOK, 0, 1, 0},
+		{"ndjson by extension", "/v1/movies/import", "movies.ndjson", ndjsonFile, http.StatusCreated, 1, 0, 1},
+		{"no valid rows", "/v1/movies/import", "movies.csv", "title,year,runtime,genres\n,1979,nope,western\n", http.StatusUnprocessableEntity, 0, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			body, header := multipartFile(t, tt.filename, tt.content)
+
+			// The import route requires the movies:import permission, which can't be
+			// granted without a database, so the handler is called directly.
+			rr := send(t, asUser(app, app.importMoviesHandler), http.MethodPost, tt.target, body, header)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d; want %d (body %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			report, _ := decodeEnvelope(t, rr)["report"].(map[string]any)
+
+			if report["imported"] != tt.wantImported {
+				t.Errorf("got %v imported; want %v", report["imported"], tt.wantImported)
+			}
+
+			if errs, _ := report["errors"].([]any); len(errs) != tt.wantErrors {
+				t.Errorf("got row errors %v; want %d", report["errors"], tt.wantErrors)
+			}
+
+			filters := data.Filters{Page: 1, PageSize: 10, Sort: "id", SortSafeList: []string{"id"}}
+
+			movies, _, err := app.models.Movies.GetAll(context.Background(), "", nil, "", nil, filters)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(movies) != tt.wantMovies {
+				t.Errorf("got %d movies stored; want %d", len(movies), tt.wantMovies)
+			}
+		})
+	}
+}
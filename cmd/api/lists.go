@@ -0,0 +1,432 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// The listListsHandler lists the lists belonging to the authenticated user.
+func (app *application) listListsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page-size", 20, v)
+	input.Sort = app.readString(qs, "sort", "name")
+	input.SortSafeList = []string{"name", "created_at", "updated_at", "-name", "-created_at", "-updated_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lists, metadata, err := app.models.Lists.GetAllForUser(r.Context(), app.contextGetUser(r).ID, input.Filters)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	e := envelope{
+		"lists":    lists,
+		"metadata": metadata,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, e, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createListHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Public      bool   `json:"public"`
+	}
+
+	err := app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	list := &data.List{
+		UserID:      app.contextGetUser(r).ID,
+		Name:        input.Name,
+		Description: input.Description,
+		Public:      input.Public,
+	}
+
+	v := validator.New()
+
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Insert(r.Context(), list)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/lists/%v", list.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"list": list}, headers)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The getListByIdHandler returns a list with a page of its items. Public lists can
+// be fetched by anyone, including anonymous users, while private lists are only
+// visible to their owner.
+func (app *application) getListByIdHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page-size", 20, v)
+	input.Sort = app.readString(qs, "sort", "position")
+	input.SortSafeList = []string{"position", "title", "added_at", "-position", "-title", "-added_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	list, err := app.models.Lists.Get(r.Context(), id)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	if !list.Public && list.UserID != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	items, metadata, err := app.models.Lists.GetItems(r.Context(), list.ID, input.Filters)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	e := envelope{
+		"list":     list,
+		"items":    items,
+		"metadata": metadata,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, e, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Public      *bool   `json:"public"`
+	}
+
+	err := app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+
+	if input.Description != nil {
+		list.Description = *input.Description
+	}
+
+	if input.Public != nil {
+		list.Public = *input.Public
+	}
+
+	v := validator.New()
+
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Update(r.Context(), list)
+
+	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := app.models.Lists.Delete(r.Context(), list.ID)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusNoContent, nil, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The addListItemHandler adds a movie to a list. Without a position the movie is
+// added to the end of the list.
+func (app *application) addListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MovieID  int64 `json:"movie_id"`
+		Position int32 `json:"position"`
+	}
+
+	err := app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	item := &data.ListItem{
+		MovieID:  input.MovieID,
+		Position: input.Position,
+	}
+
+	v := validator.New()
+
+	if data.ValidateListItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.AddItem(r.Context(), list.ID, item)
+
+	if err != nil {
+		switch {
+		// The list was read above, so a missing record here is the movie.
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "must refer to an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateListItem):
+			v.AddError("movie_id", "is already on this list")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"item": item}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The moveListItemHandler reorders a list by moving one of its movies to a new
+// position.
+func (app *application) moveListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+
+	if !ok {
+		return
+	}
+
+	movieID, err := app.readMovieIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Position int32 `json:"position"`
+	}
+
+	err = app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	item := &data.ListItem{
+		MovieID:  movieID,
+		Position: input.Position,
+	}
+
+	v := validator.New()
+
+	v.Check(item.Position > 0, "position", "must be a positive integer")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.MoveItem(r.Context(), list.ID, item)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"item": item}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+
+	if !ok {
+		return
+	}
+
+	movieID, err := app.readMovieIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Lists.RemoveItem(r.Context(), list.ID, movieID)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusNoContent, nil, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readOwnList() helper reads the list in the "id" URL parameter for handlers
+// which change a list. If the list doesn't belong to the authenticated user it
+// sends an error response and returns false. The private lists of other users are
+// reported as not found, so that their existence isn't revealed.
+func (app *application) readOwnList(w http.ResponseWriter, r *http.Request) (*data.List, bool) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	list, err := app.models.Lists.Get(r.Context(), id)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return nil, false
+	}
+
+	if list.UserID != app.contextGetUser(r).ID {
+		if list.Public {
+			app.notPermittedResponse(w, r)
+		} else {
+			app.notFoundResponse(w, r)
+		}
+
+		return nil, false
+	}
+
+	return list, true
+}
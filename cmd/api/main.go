@@ -3,18 +3,16 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
-	"fmt"
+	"io"
 	"log/slog"
-	"net/http"
 	"os"
 	"time"
 
-	// Import the pq driver so that it can register itself with the database/sql
-	// package. Note that we alias this import to the blank identifier, to stop the Go
-	// compiler complaining that the package isn't being used.
-	_ "github.com/lib/pq"
 	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/storage"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/trace"
 )
 
 const version = "1.0.0"
@@ -34,13 +32,48 @@ type config struct {
 
 		// the duration a connection can be idle.
 		maxIdleTime time.Duration
+
+		// how long a single query may run before it is canceled.
+		queryTimeout time.Duration
+	}
+	// how long the response to a request with an Idempotency-Key header is kept
+	// for replaying.
+	idempotencyTTL time.Duration
+	// where uploaded images are stored on disk, and the base URL they are served
+	// from.
+	storage struct {
+		dir     string
+		baseURL string
+	}
+	// how long the catalogue statistics are cached for. 0 disables the cache.
+	statsCacheTTL time.Duration
+	// how much the genres, year and runtime of two movies count towards how similar
+	// they are.
+	similarity data.SimilarityWeights
+	// how often the index similar movies are scored against is rebuilt.
+	similarityIndexInterval time.Duration
+	// the format (text or json) and minimum level of log entries.
+	log struct {
+		format string
+		level  slog.Level
+	}
+	// where spans are written as OTLP/JSON: "stdout", a file path, or empty to
+	// disable tracing.
+	trace struct {
+		output string
 	}
 }
 
 type application struct {
-	config config
-	logger *slog.Logger
-	models data.Models
+	config  config
+	logger  *slog.Logger
+	models  data.Models
+	storage storage.Storage
+	// the tracer which records spans for requests and queries. It is nil when
+	// tracing is disabled.
+	tracer *trace.Tracer
+	// the cached catalogue statistics, keyed by the filters they were computed for.
+	movieStats ttlCache[*data.MovieStats]
 }
 
 func main() {
@@ -61,13 +94,81 @@ func main() {
 	flag.IntVar(&config.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&config.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.DurationVar(&config.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
+	flag.DurationVar(&config.db.queryTimeout, "db-query-timeout", 3*time.Second, "PostgreSQL query timeout")
+
+	flag.DurationVar(&config.idempotencyTTL, "idempotency-ttl", 24*time.Hour, "How long Idempotency-Key responses are kept")
+
+	flag.StringVar(&config.storage.dir, "storage-dir", "./uploads", "Directory uploaded images are stored in")
+	flag.StringVar(&config.storage.baseURL, "storage-url", "/v1/images", "Base URL uploaded images are served from")
+
+	flag.DurationVar(&config.statsCacheTTL, "stats-cache-ttl", 30*time.Second, "How long catalogue statistics are cached (0 to disable)")
+
+	flag.Float64Var(&config.similarity.Genres, "similar-genre-weight", 0.6, "Weight of shared genres in similar movies")
+	flag.Float64Var(&config.similarity.Year, "similar-year-weight", 0.25, "Weight of year proximity in similar movies")
+	flag.Float64Var(&config.similarity.Runtime, "similar-runtime-weight", 0.15, "Weight of runtime similarity in similar movies")
+	flag.DurationVar(&config.similarityIndexInterval, "similar-index-interval", 10*time.Minute, "How often the similar movies index is rebuilt")
+
+	// The log format is checked as the flag is parsed, so an unknown format stops the
+	// server from starting.
+	config.log.format = "text"
+
+	flag.Func("log-format", "Log format (text|json) (default text)", func(s string) error {
+		if s != "text" && s != "json" {
+			return errors.New("must be text or json")
+		}
+
+		config.log.format = s
+		return nil
+	})
+
+	// The level is parsed by slog.Level, which accepts names like "debug" or "warn"
+	// and offsets like "info+2".
+	flag.TextVar(&config.log.level, "log-level", slog.LevelInfo, "Minimum log level (debug|info|warn|error)")
+
+	flag.StringVar(&config.trace.output, "trace-output", "", "Where OTLP/JSON spans are written (stdout or a file path; empty disables tracing)")
 
 	flag.Parse()
 
 	// Initialize a new structured logger which writes log entries to the standard out stream.
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	logger := newLogger(os.Stdout, config.log.format, config.log.level)
+
+	// The data package logs through the request-scoped logger in the context, and
+	// falls back to the default logger for work outside a request.
+	slog.SetDefault(logger)
+
+	// The similarity score is a weighted average, so the weights can't be negative
+	// and at least one of them must be positive.
+	weights := config.similarity
+
+	if min(weights.Genres, weights.Year, weights.Runtime) < 0 || weights.Genres+weights.Year+weights.Runtime <= 0 {
+		logger.Error("the -similar-*-weight flags must not be negative and must not all be 0")
+		os.Exit(1)
+	}
 
-	db, err := openDB(config)
+	if config.similarityIndexInterval <= 0 {
+		logger.Error("the -similar-index-interval flag must be positive")
+		os.Exit(1)
+	}
+
+	if config.db.queryTimeout <= 0 {
+		logger.Error("the -db-query-timeout flag must be positive")
+		os.Exit(1)
+	}
+
+	tracer, traceFile, err := newTracer(config.trace.output, logger)
+
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// The trace file is closed once serve() has shut the tracer down and written the
+	// last spans to it.
+	if traceFile != nil {
+		defer traceFile.Close()
+	}
+
+	db, err := openDB(config, tracer)
 
 	if err != nil {
 		logger.Error(err.Error())
@@ -78,47 +179,148 @@ func main() {
 	// main function exits.
 	defer db.Close()
 
+	store, err := storage.NewLocal(config.storage.dir, config.storage.baseURL)
+
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	// Declare an instance of the application struct containing the config struct and the logger.
 	app := &application{
-		config: config,
-		logger: logger,
-		models: data.NewModels(db),
+		config:  config,
+		logger:  logger,
+		models:  data.NewModels(db, config.db.queryTimeout),
+		storage: store,
+		tracer:  tracer,
 	}
 
 	app.logger.Info("database connection pool established")
 
-	// Declare a HTTP server which listens on the port provided in the config struct, uses
-	// the servemux we created above as the handler, has some sensible timeout settings
-	// and writes any log messages to the structured logger at Error level.
-	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", config.port),
-		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	// Expired idempotency keys are only overwritten when the same key is used again,
+	// so we delete them in the background to stop the table growing without bound.
+	go app.deleteExpiredIdempotencyKeys(time.Hour)
+
+	// Similar movies are scored against an in-memory index of the catalogue, which is
+	// built before the server starts and then kept up to date in the background.
+	// The similar movies index is built in the background, so that the API starts
+	// even if it can't be built straight away.
+	go app.rebuildSimilarityIndex(config.similarityIndexInterval)
+
+	err = app.serve()
+
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
+}
 
-	// Start the HTTP server
-	logger.Info(fmt.Sprintf("Starting server %v %v", server.Addr, config.env))
+// newLogger creates a structured logger which writes entries of at least the given
+// level to w, either as logfmt-style text or as one JSON object per line.
+func newLogger(w io.Writer, format string, level slog.Level) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
 
-	err = server.ListenAndServe()
+	return slog.New(slog.NewTextHandler(w, opts))
+}
 
-	// If the server errors out send the error to the structured logger
-	logger.Error(err.Error())
+// newTracer creates a tracer which writes OTLP/JSON spans to stdout or to the file
+// at output, which is appended to. Errors writing spans are logged. A nil tracer is
+// returned when output is empty. The file, if one was opened, is returned so that
+// it can be closed once the tracer has been shut down.
+func newTracer(output string, logger *slog.Logger) (*trace.Tracer, *os.File, error) {
+	var w io.Writer
+	var f *os.File
+
+	switch output {
+	case "":
+		return nil, nil, nil
+	case "stdout":
+		w = os.Stdout
+	default:
+		var err error
+
+		f, err = os.OpenFile(output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		w = f
+	}
 
-	// Exit gracefully
-	os.Exit(1)
+	exporter := trace.NewJSONExporter(w, "lets-go-further", version)
+	exporter.ErrorLog = func(err error) {
+		logger.Error(err.Error())
+	}
+
+	return trace.New(exporter), f, nil
+}
+
+// deleteExpiredIdempotencyKeys deletes the expired idempotency keys once every
+// interval. It runs until the process exits, and errors are logged rather than
+// stopping it.
+func (app *application) deleteExpiredIdempotencyKeys(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := app.models.Idempotency.DeleteExpired(context.Background())
+
+		if err != nil {
+			app.logger.Error(err.Error())
+			continue
+		}
+
+		app.logger.Debug("deleted expired idempotency keys", "count", deleted)
+	}
+}
+
+// rebuildSimilarityIndex builds the similar movies index and then rebuilds it once
+// every interval. It runs until the process exits, and errors are logged rather
+// than stopping it, in which case the previous index is kept. Until the index has
+// been built once, a failed build is retried after a minute rather than a whole
+// interval, so that a database which was briefly unavailable at startup doesn't
+// leave every movie without similar movies for long.
+func (app *application) rebuildSimilarityIndex(interval time.Duration) {
+	built := false
+
+	for {
+		wait := interval
+
+		err := app.models.Similarity.Rebuild(context.Background())
+
+		if err != nil {
+			app.logger.Error(err.Error())
+
+			if !built {
+				wait = min(interval, time.Minute)
+			}
+		} else {
+			built = true
+			app.logger.Debug("rebuilt similar movies index")
+		}
+
+		time.Sleep(wait)
+	}
 }
 
-func openDB(config config) (*sql.DB, error) {
-	// Use sql.Open() to create an empty connection pool using the dsn from the config struct
-	db, err := sql.Open("postgres", config.db.dsn)
+func openDB(config config, tracer *trace.Tracer) (*sql.DB, error) {
+	// Create a connector for the dsn from the config struct. It tags each query with
+	// the ID of the request it was made for, so that the database logs can be
+	// matched with ours, and records a span for it when tracing is enabled.
+	connector, err := data.NewConnector(config.db.dsn, tracer)
 
 	if err != nil {
 		return nil, err
 	}
 
+	// Use sql.OpenDB() to create an empty connection pool using the connector.
+	db := sql.OpenDB(connector)
+
 	// Set the maximum number of open (in-use + idle) connections in the pool. Note that
 	// passing a value less than or equal to 0 will mean there is no limit.
 	db.SetMaxOpenConns(config.db.maxOpenConns)
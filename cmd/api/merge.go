@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// The listDuplicateMoviesHandler returns pairs of movies which look like the same
+// film, so that they can be reviewed and merged. The runtime-tolerance parameter
+// is how many minutes apart the runtimes of a pair can be.
+func (app *application) listDuplicateMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+		RuntimeTolerance int
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.RuntimeTolerance = app.readInt(qs, "runtime-tolerance", 5, v)
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page-size", 20, v)
+	input.Sort = app.readString(qs, "sort", "id")
+	input.SortSafeList = []string{"id", "-id"}
+
+	v.Check(input.RuntimeTolerance >= 0, "runtime-tolerance", "must not be negative")
+	v.Check(input.RuntimeTolerance <= 60, "runtime-tolerance", "must not be more than 60")
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	duplicates, metadata, err := app.models.Movies.GetDuplicates(r.Context(), int32(input.RuntimeTolerance), input.Filters)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	e := envelope{
+		"duplicates": duplicates,
+		"metadata":   metadata,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, e, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The mergeMovieHandler folds the movie in the URL into another movie, moving its
+// ratings, reviews and other data across. Afterwards requests for the merged movie
+// are redirected to the movie it was merged into.
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		IntoMovieID int64 `json:"into_movie_id"`
+	}
+
+	err = app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.IntoMovieID > 0, "into_movie_id", "must be provided")
+	v.Check(input.IntoMovieID != id, "into_movie_id", "must not be the movie itself")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireMovie(w, r, id) {
+		return
+	}
+
+	discarded, err := app.models.Movies.Merge(r.Context(), id, input.IntoMovieID, app.editor(r))
+
+	if err != nil {
+		// The movie was checked above, so a missing record here is the movie it was
+		// being merged into.
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("into_movie_id", "must refer to an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	// The images which the other movie already had its own of are no longer used.
+	for _, img := range discarded {
+		app.deleteMovieImage(img)
+	}
+
+	movie, err := app.models.Movies.Get(r.Context(), input.IntoMovieID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
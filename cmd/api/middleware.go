@@ -1,8 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/trace"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
 )
 
 // This is the middleware pattern!!!
@@ -33,3 +47,437 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// The requestID middleware stores an ID for every request in the request context,
+// so that it can be recorded alongside any changes the request makes, and returns
+// it in the X-Request-ID header. A client or proxy can pass its own ID in the same
+// header to correlate our logs with theirs; IDs which don't look safe to copy into
+// headers and logs are replaced with a random one.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+
+		if !validator.Matches(requestID, data.RequestIDRX) {
+			b := make([]byte, 16)
+
+			_, err := rand.Read(b)
+
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			requestID = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+
+		r = app.contextSetRequestID(r, requestID)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The authenticate middleware adds the user that owns the bearer token in the
+// Authorization header to the request context. Requests without an Authorization
+// header are treated as coming from the anonymous user.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Add the "Vary: Authorization" header to the response. This indicates to any
+		// caches that the response may vary based on the value of the Authorization
+		// header in the request.
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// We expect the value of the Authorization header to be in the format
+		// "Bearer <token>".
+		headerParts := strings.Split(authorizationHeader, " ")
+
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		token := headerParts[1]
+
+		v := validator.New()
+
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, err := app.models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
+
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.invalidAuthenticationTokenResponse(w, r)
+			} else {
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireAuthenticatedUser middleware checks that the user is not anonymous.
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// The requirePermission middleware checks that the authenticated user has been
+// granted the given permission code.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+
+	// Wrap this with the requireAuthenticatedUser() middleware, so that anonymous
+	// users get a 401 rather than a 403.
+	return app.requireAuthenticatedUser(fn)
+}
+
+// The maximum size of a request or response body handled by the idempotent
+// middleware. Responses larger than this are sent but not stored for replaying.
+const maxIdempotentBodyBytes = 1_048_576
+
+// The idempotentResponseWriter passes the response through to the client while
+// keeping a copy of the status code and body, so that they can be replayed.
+type idempotentResponseWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rw *idempotentResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *idempotentResponseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+
+	if !rw.overflow {
+		if rw.body.Len()+len(b) > maxIdempotentBodyBytes {
+			rw.overflow = true
+			rw.body.Reset()
+		} else {
+			rw.body.Write(b)
+		}
+	}
+
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter.
+func (rw *idempotentResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// The idempotent middleware makes a POST handler safe to retry. When a request has
+// an Idempotency-Key header, the response is stored against the key and replayed
+// for any repeat of the same request within the configured TTL. Reusing the key
+// for a different request is rejected. Server errors aren't stored, so the client
+// can retry them with the same key.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			app.badRequestResponse(w, r, errors.New("Idempotency-Key header must not be more than 255 bytes long"))
+			return
+		}
+
+		// Read the whole body so it can be included in the fingerprint, and then
+		// replace it so the handler can read it as normal.
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+
+			if errors.As(err, &maxBytesError) {
+				app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+			} else {
+				app.badRequestResponse(w, r, err)
+			}
+
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The fingerprint identifies the request, so that a key reused for a
+		// different URL or body can be detected.
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.RequestURI())
+		hash.Write(body)
+		fingerprint := hash.Sum(nil)
+
+		userID := app.contextGetUser(r).ID
+
+		record, reserved, err := app.models.Idempotency.Reserve(r.Context(), key, userID, fingerprint, app.config.idempotencyTTL)
+
+		if err != nil {
+			// The record can disappear between the reservation failing and reading
+			// it, if the original request failed and released the key.
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.idempotencyKeyInUseResponse(w, r)
+			} else {
+				app.serverErrorResponse(w, r, err)
+			}
+
+			return
+		}
+
+		if !reserved {
+			switch {
+			case !bytes.Equal(record.Fingerprint, fingerprint):
+				app.idempotencyKeyMismatchResponse(w, r)
+			case record.Status == nil:
+				app.idempotencyKeyInUseResponse(w, r)
+			default:
+				if record.ContentType != "" {
+					w.Header().Set("Content-Type", record.ContentType)
+				}
+
+				if record.Location != "" {
+					w.Header().Set("Location", record.Location)
+				}
+
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(*record.Status)
+				w.Write(record.Body)
+			}
+
+			return
+		}
+
+		rw := &idempotentResponseWriter{ResponseWriter: w}
+		completed := false
+
+		// The key must be released or completed even if the client has gone away, so
+		// those queries use a context which isn't canceled with the request.
+		ctx := context.WithoutCancel(r.Context())
+
+		// Release the key if the handler panics or its response can't be stored, so
+		// that the client isn't locked out of retrying until the key expires.
+		defer func() {
+			if !completed {
+				err := app.models.Idempotency.Release(ctx, key, userID)
+
+				if err != nil {
+					app.logError(r, err)
+				}
+			}
+		}()
+
+		next(rw, r)
+
+		// A request which was canceled or timed out (499 or 503) never finished, so
+		// its response is a reason to retry rather than the outcome to replay, and
+		// the key is released like it is for any other server error.
+		if rw.status >= http.StatusInternalServerError || rw.status == statusClientClosedRequest || rw.overflow || r.Context().Err() != nil {
+			return
+		}
+
+		status := rw.status
+
+		err = app.models.Idempotency.Complete(ctx, &data.IdempotencyRecord{
+			Key:         key,
+			UserID:      userID,
+			Status:      &status,
+			ContentType: rw.Header().Get("Content-Type"),
+			Location:    rw.Header().Get("Location"),
+			Body:        rw.body.Bytes(),
+		})
+
+		if err != nil {
+			// The response has already been sent, so all we can do is log the error.
+			app.logError(r, err)
+			return
+		}
+
+		completed = true
+	}
+}
+
+// A statusRecorder wraps a http.ResponseWriter to record the status code and the
+// number of bytes of the response for the request log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if !sr.wroteHeader {
+		sr.status = status
+		sr.wroteHeader = true
+	}
+
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	sr.wroteHeader = true
+
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+
+	return n, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, so that http.ResponseController
+// can still flush the response and set deadlines through the recorder.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// The logRequest middleware adds a request-scoped logger to the request context and
+// logs every request once it has been handled. It must run inside the requestID
+// middleware so that the request ID is available.
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		r = app.contextSetRoute(r)
+
+		logger := app.logger.With(
+			"request_id", app.contextGetRequestID(r),
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"client_ip", clientIP(r),
+		)
+
+		// Requests which are traced are logged with their trace ID, so that the log
+		// entries can be found from a trace and the other way round.
+		if span := trace.SpanFromContext(r.Context()); span != nil {
+			logger = logger.With("trace_id", fmt.Sprintf("%x", span.SpanContext.TraceID))
+		}
+
+		r = app.contextSetLogger(r, logger)
+
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(sr, r)
+
+		logger.Info(
+			"request completed",
+			"route", app.contextGetRoute(r),
+			"status", sr.status,
+			"bytes", sr.bytes,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// The traceRequest middleware records a server span for every request, which the
+// spans of the queries made while handling it are children of. If the request has
+// a valid W3C traceparent header the caller's trace is continued, and otherwise a
+// new one is started. It does nothing when tracing is disabled.
+func (app *application) traceRequest(next http.Handler) http.Handler {
+	if app.tracer == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = app.contextSetRoute(r)
+
+		ctx := r.Context()
+
+		if sc, ok := trace.ParseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = trace.ContextWithRemote(ctx, sc)
+		}
+
+		// The route is only known once the router has handled the request, so the
+		// span is renamed after it then.
+		ctx, span := app.tracer.Start(ctx, r.Method, trace.SpanKindServer)
+		defer span.End()
+
+		span.SetAttributes(
+			trace.Attribute{Key: "http.request.method", Value: r.Method},
+			trace.Attribute{Key: "url.path", Value: r.URL.Path},
+			trace.Attribute{Key: "client.address", Value: clientIP(r)},
+			trace.Attribute{Key: "request.id", Value: app.contextGetRequestID(r)},
+		)
+
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(sr, r.WithContext(ctx))
+
+		// Spans are named after the route rather than the path, so that requests for
+		// different records are grouped together.
+		if route := app.contextGetRoute(r); route != "" {
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(trace.Attribute{Key: "http.route", Value: route})
+		}
+
+		span.SetAttributes(trace.Attribute{Key: "http.response.status_code", Value: sr.status})
+
+		// Only server errors mark the span as failed, since a 4xx response means the
+		// server did its job.
+		if sr.status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(sr.status)))
+		}
+	})
+}
+
+// clientIP returns the IP address of the client which made the request, without the
+// port. The X-Forwarded-For header is ignored, since it can be set by anyone when
+// the API isn't behind a trusted proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	app := newTestApplication(t)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something went wrong")
+	})
+
+	rr := send(t, app.requestID(app.recoverPanic(next)), http.MethodGet, "/", "", nil)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusInternalServerError)
+	}
+
+	if got := rr.Header().Get("Connection"); got != "close" {
+		t.Errorf("got Connection header %q; want %q", got, "close")
+	}
+
+	e := decodeEnvelope(t, rr)
+
+	if e["request_id"] != rr.Header().Get("X-Request-ID") {
+		t.Errorf("got request_id %q; want %q", e["request_id"], rr.Header().Get("X-Request-ID"))
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	app := newTestApplication(t)
+
+	var got string
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = app.contextGetRequestID(r)
+	})
+
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	tests := []struct {
+		name     string
+		incoming string
+		want     string
+	}{
+		{"missing", "", ""},
+		{"valid", "req-1234.abc:5_6", "req-1234.abc:5_6"},
+		{"invalid characters", "req 1234\nInjected: header", ""},
+		{"too long", strings.Repeat("a", 129), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+
+			if tt.incoming != "" {
+				header.Set("X-Request-ID", tt.incoming)
+			}
+
+			rr := send(t, app.requestID(next), http.MethodGet, "/", "", header)
+
+			returned := rr.Header().Get("X-Request-ID")
+
+			if returned != got {
+				t.Errorf("got X-Request-ID header %q; want the context value %q", returned, got)
+			}
+
+			if tt.want != "" && got != tt.want {
+				t.Errorf("got request ID %q; want %q", got, tt.want)
+			}
+
+			if tt.want == "" && !generated.MatchString(got) {
+				t.Errorf("got request ID %q; want a generated one", got)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	app := newTestApplication(t)
+
+	var called bool
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+
+		if !app.contextGetUser(r).IsAnonymous() {
+			t.Error("got an authenticated user; want the anonymous user")
+		}
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{"anonymous", "", http.StatusOK},
+		{"missing scheme", "ABCDEFGHIJKLMNOPQRSTUVWXYZ", http.StatusUnauthorized},
+		{"wrong scheme", "Basic ABCDEFGHIJKLMNOPQRSTUVWXYZ", http.StatusUnauthorized},
+		{"malformed token", "Bearer abc", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = false
+
+			header := http.Header{}
+
+			if tt.authorization != "" {
+				header.Set("Authorization", tt.authorization)
+			}
+
+			rr := send(t, app.authenticate(next), http.MethodGet, "/", "", header)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantStatus)
+			}
+
+			if called != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("got next called %t; want %t", called, tt.wantStatus == http.StatusOK)
+			}
+
+			if tt.wantStatus == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("got WWW-Authenticate header %q; want %q", rr.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+}
+
+func TestLogRequestRoute(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"parameter", "/v1/movies/abc/revisions", "/v1/movies/:id/revisions"},
+		{"parameter equal to a fixed segment", "/v1/movies/movies", "/v1/movies/:id"},
+		{"fixed segment", "/v1/movies/export", "/v1/movies/export"},
+		{"no route", "/v1/nothing", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			var buf bytes.Buffer
+			app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+			send(t, app.routes(), http.MethodGet, tt.target, "", nil)
+
+			var entry struct {
+				Msg   string `json:"msg"`
+				Route string `json:"route"`
+			}
+
+			for line := range strings.Lines(buf.String()) {
+				err := json.Unmarshal([]byte(line), &entry)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if entry.Msg == "request completed" {
+					break
+				}
+			}
+
+			if entry.Msg != "request completed" {
+				t.Fatalf("got no request log entry in %q", buf.String())
+			}
+
+			if entry.Route != tt.want {
+				t.Errorf("got route %q; want %q", entry.Route, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,11 @@ package main
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
 	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
@@ -16,6 +20,8 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		Year    int32        `json:"year"`
 		Runtime data.Runtime `json:"runtime"`
 		Genres  []string     `json:"genres"`
+		// The ids of the movie in other catalogues, like {"imdb": "tt0111161"}.
+		ExternalIDs data.ExternalIDs `json:"external_ids"`
 	}
 
 	// read the request body json into the input anonymouse struct
@@ -27,23 +33,61 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:       input.Title,
+		Year:        input.Year,
+		Runtime:     input.Runtime,
+		Genres:      input.Genres,
+		ExternalIDs: input.ExternalIDs,
+	}
+
+	// Load the known genres, which the genres of the movie are validated against.
+	genres, err := app.models.Genres.GetAll(r.Context())
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	// Refuse to create a second movie for an external id which is already mapped, so
+	// that syncing the same movie twice doesn't duplicate it. The sources are sorted
+	// so that the same error is reported for the same request.
+	for _, source := range slices.Sorted(maps.Keys(movie.ExternalIDs)) {
+		id := movie.ExternalIDs[source]
+
+		movieID, err := app.models.ExternalIDs.GetMovieID(r.Context(), source, id)
+
+		switch {
+		case err == nil:
+			v.AddError("external_ids", fmt.Sprintf("%v id %q is already mapped to movie %d", source, id, movieID))
+		case !errors.Is(err, data.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Movies.Insert(r.Context(), movie, app.editor(r))
 
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		// The ids were checked above, but another request may have mapped one since.
+		if errors.Is(err, data.ErrDuplicateExternalID) {
+			v.AddError("external_ids", "must not already be mapped to another movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
 		return
 	}
 
@@ -69,7 +113,71 @@ func (app *application) getMovieByIdHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	// The include parameter lists related data to load along with the movie.
+	v := validator.New()
+
+	include := app.readCSV(r.URL.Query(), "include", []string{})
+
+	for _, value := range include {
+		v.Check(validator.PermittedValue(value, "credits"), "include", "must only contain credits")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The title and overview are translated into the best locale the client accepts
+	// which the movie has a translation for.
+	movie, err := app.models.Movies.GetLocalized(r.Context(), id, app.readLocales(r))
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.redirectMergedMovie(w, r, id)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	// The credits are loaded with a single query which joins the people table.
+	if slices.Contains(include, "credits") {
+		credits, err := app.models.People.GetCreditsForMovies(r.Context(), []int64{movie.ID})
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		movie.Credits = credits[movie.ID]
+
+		if movie.Credits == nil {
+			movie.Credits = []*data.Credit{}
+		}
+	}
+
+	// The response depends on the Accept-Language header, so caches must store a
+	// copy for each value of it.
+	headers := make(http.Header)
+	headers.Set("Vary", "Accept-Language")
+
+	if movie.Locale != "" {
+		headers.Set("Content-Language", movie.Locale)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The redirectMergedMovie() helper sends a permanent redirect to the movie which a
+// missing movie was merged into, keeping the query string. If the movie wasn't
+// merged a not found response is sent instead.
+func (app *application) redirectMergedMovie(w http.ResponseWriter, r *http.Request, id int64) {
+	movieID, err := app.models.Movies.GetRedirect(r.Context(), id)
 
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
@@ -81,7 +189,12 @@ func (app *application) getMovieByIdHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	location := url.URL{Path: fmt.Sprintf("/v1/movies/%d", movieID), RawQuery: r.URL.RawQuery}
+
+	headers := make(http.Header)
+	headers.Set("Location", location.String())
+
+	err = app.writeJSON(w, http.StatusMovedPermanently, envelope{"movie_id": movieID}, headers)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -96,7 +209,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(r.Context(), id)
 
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
@@ -145,14 +258,22 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		movie.Genres = input.Genres
 	}
 
+	// Load the known genres, which the genres of the movie are validated against.
+	genres, err := app.models.Genres.GetAll(r.Context())
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(r.Context(), movie, app.editor(r))
 
 	if err != nil {
 		if errors.Is(err, data.ErrEditConflict) {
@@ -179,18 +300,23 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	images, err := app.models.Movies.Delete(r.Context(), id, app.editor(r))
 
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			app.notFoundResponse(w, r)
 		} else {
-			app.badRequestResponse(w, r, err)
+			app.serverErrorResponse(w, r, err)
 		}
 
 		return
 	}
 
+	// The movie is gone, so the files of its poster and backdrop can be removed.
+	for _, img := range images {
+		app.deleteMovieImage(img)
+	}
+
 	err = app.writeJSON(w, http.StatusNoContent, nil, nil)
 
 	if err != nil {
@@ -203,8 +329,9 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	var input struct {
 		// We embedd the filters struct into the input struct
 		data.Filters
-		Title  string
-		Genres []string
+		Title   string
+		Genres  []string
+		Country string
 	}
 
 	// Create a validator
@@ -215,17 +342,23 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 
 	input.Title = app.readString(qs, "title", "")
 	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.Country = strings.ToUpper(app.readString(qs, "country", ""))
 	input.Page = app.readInt(qs, "page", 1, v)
 	input.PageSize = app.readInt(qs, "page-size", 20, v)
 	input.Sort = app.readString(qs, "sort", "title")
-	input.SortSafeList = []string{"title", "genres", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.SortSafeList = []string{"title", "genres", "year", "runtime", "rating", "-id", "-title", "-year", "-runtime", "-rating"}
+
+	// Only movies released in the country are listed when one is given.
+	if input.Country != "" {
+		v.Check(validator.Matches(input.Country, data.CountryRX), "country", "must be a two letter country code like GB")
+	}
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(r.Context(), input.Title, input.Genres, input.Country, app.readLocales(r), input.Filters)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -237,7 +370,10 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		"movies":   movies,
 	}
 
-	err = app.writeJSON(w, http.StatusOK, e, nil)
+	headers := make(http.Header)
+	headers.Set("Vary", "Accept-Language")
+
+	err = app.writeJSON(w, http.StatusOK, e, headers)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
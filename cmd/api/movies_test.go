@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+)
+
+func TestCreateMovie(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantErrors map[string]any
+	}{
+		{
+			name:       "valid",
+			body:       `{"title": "Moon", "year": 2009, "runtime": "97 mins", "genres": ["drama", "sci-fi"]}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "badly-formed JSON",
+			body:       `{"title": "Moon",}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid runtime",
+			body:       `{"title": "Moon", "year": 2009, "runtime": "97 minutes", "genres": ["drama"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown field",
+			body:       `{"title": "Moon", "rating": 8}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing fields",
+			body:       `{}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: map[string]any{
+				"title":   "must be provided",
+				"year":    "must be provided",
+				"runtime": "must be provided",
+				"genres":  "must have at least 1 genre",
+			},
+		},
+		{
+			name:       "unknown genre",
+			body:       `{"title": "Moon", "year": 2009, "runtime": "97 mins", "genres": ["western"]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			rr := send(t, app.routes(), http.MethodPost, "/v1/movies", tt.body, nil)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d; want %d (body %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			e := decodeEnvelope(t, rr)
+
+			if tt.wantStatus == http.StatusCreated {
+				if got := rr.Header().Get("Location"); got != "/v1/movies/1" {
+					t.Errorf("got Location header %q; want %q", got, "/v1/movies/1")
+				}
+
+				movie := e["movie"].(map[string]any)
+
+				if movie["title"] != "Moon" || movie["version"] != float64(1) {
+					t.Errorf("got movie %v; want Moon at version 1", movie)
+				}
+
+				if _, ok := movie["external_ids"]; ok {
+					t.Errorf("got external_ids %v; want them omitted", movie["external_ids"])
+				}
+			}
+
+			if tt.wantErrors != nil {
+				errs := e["error"].(map[string]any)
+
+				for key, want := range tt.wantErrors {
+					if errs[key] != want {
+						t.Errorf("got %s error %v; want %q", key, errs[key], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGetMovie(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	insertTestMovie(t, app, "Moon", 2009, 97, "Drama", "Sci-Fi")
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{"existing", "/v1/movies/1", http.StatusOK},
+		{"missing", "/v1/movies/2", http.StatusNotFound},
+		{"zero id", "/v1/movies/0", http.StatusNotFound},
+		{"negative id", "/v1/movies/-1", http.StatusNotFound},
+		{"non-numeric id", "/v1/movies/moon", http.StatusNotFound},
+		{"overflowing id", "/v1/movies/9223372036854775808", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := send(t, routes, http.MethodGet, tt.target, "", nil)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d; want %d (body %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			if rr.Code == http.StatusOK {
+				movie := decodeEnvelope(t, rr)["movie"].(map[string]any)
+
+				if movie["title"] != "Moon" {
+					t.Errorf("got title %v; want %q", movie["title"], "Moon")
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateMovie(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		wantStatus  int
+		wantTitle   string
+		wantVersion float64
+	}{
+		{"title", "/v1/movies/1", `{"title": "Moon (2009)"}`, http.StatusOK, "Moon (2009)", 2},
+		{"nothing", "/v1/movies/1", `{}`, http.StatusOK, "Moon", 2},
+		{"empty title", "/v1/movies/1", `{"title": ""}`, http.StatusUnprocessableEntity, "", 0},
+		{"duplicate genres", "/v1/movies/1", `{"genres": ["drama", "drama"]}`, http.StatusUnprocessableEntity, "", 0},
+		{"wrong type", "/v1/movies/1", `{"year": "2009"}`, http.StatusBadRequest, "", 0},
+		{"empty body", "/v1/movies/1", ``, http.StatusBadRequest, "", 0},
+		{"missing movie", "/v1/movies/2", `{"title": "Moon (2009)"}`, http.StatusNotFound, "", 0},
+		{"invalid id", "/v1/movies/abc", `{"title": "Moon (2009)"}`, http.StatusNotFound, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			insertTestMovie(t, app, "Moon", 2009, 97, "Drama", "Sci-Fi")
+
+			rr := send(t, app.routes(), http.MethodPatch, tt.target, tt.body, nil)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d; want %d (body %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			movie := decodeEnvelope(t, rr)["movie"].(map[string]any)
+
+			if movie["title"] != tt.wantTitle || movie["version"] != tt.wantVersion {
+				t.Errorf("got %v at version %v; want %q at version %v", movie["title"], movie["version"], tt.wantTitle, tt.wantVersion)
+			}
+		})
+	}
+}
+
+// conflictingMovies is a movie repository which updates a movie behind the back of
+// the caller just before every update, like a concurrent request would.
+type conflictingMovies struct {
+	*data.MemoryMovies
+}
+
+func (m conflictingMovies) Update(ctx context.Context, movie *data.Movie, editor data.Editor) error {
+	other, err := m.MemoryMovies.Get(ctx, movie.ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = m.MemoryMovies.Update(ctx, other, editor)
+
+	if err != nil {
+		return err
+	}
+
+	return m.MemoryMovies.Update(ctx, movie, editor)
+}
+
+func TestUpdateMovieEditConflict(t *testing.T) {
+	app := newTestApplication(t)
+
+	insertTestMovie(t, app, "Moon", 2009, 97, "Drama", "Sci-Fi")
+
+	app.models.Movies = conflictingMovies{app.models.Movies.(*data.MemoryMovies)}
+
+	rr := send(t, app.routes(), http.MethodPatch, "/v1/movies/1", `{"title": "Moon (2009)"}`, nil)
+
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("got status %d; want %d (body %s)", rr.Code, http.StatusConflict, rr.Body.String())
+	}
+
+	movie, err := app.models.Movies.Get(context.Background(), 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if movie.Title != "Moon" || movie.Version != 2 {
+		t.Errorf("got %q at version %d; want %q at version 2", movie.Title, movie.Version, "Moon")
+	}
+}
+
+func TestDeleteMovie(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	insertTestMovie(t, app, "Moon", 2009, 97, "Drama", "Sci-Fi")
+
+	steps := []struct {
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{http.MethodDelete, "/v1/movies/1", http.StatusNoContent},
+		{http.MethodGet, "/v1/movies/1", http.StatusNotFound},
+		{http.MethodDelete, "/v1/movies/1", http.StatusNotFound},
+		{http.MethodDelete, "/v1/movies/abc", http.StatusNotFound},
+	}
+
+	for _, step := range steps {
+		rr := send(t, routes, step.method, step.target, "", nil)
+
+		if rr.Code != step.wantStatus {
+			t.Errorf("%s %s: got status %d; want %d", step.method, step.target, rr.Code, step.wantStatus)
+		}
+	}
+}
+
+// failingDeletes is a movie repository whose deletes fail with err.
+type failingDeletes struct {
+	*data.MemoryMovies
+	err error
+}
+
+func (m failingDeletes) Delete(ctx context.Context, id int64, editor data.Editor) ([]data.Image, error) {
+	return nil, m.err
+}
+
+func TestDeleteMovieErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"timeout", context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{"canceled", context.Canceled, statusClientClosedRequest},
+		{"other error", errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.models.Movies = failingDeletes{MemoryMovies: app.models.Movies.(*data.MemoryMovies), err: tt.err}
+
+			rr := send(t, app.routes(), http.MethodDelete, "/v1/movies/1", "", nil)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestListMovies(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	insertTestMovie(t, app, "Moon", 2009, 97, "Drama", "Sci-Fi")
+	insertTestMovie(t, app, "Alien", 1979, 117, "Sci-Fi")
+	insertTestMovie(t, app, "Airplane!", 1980, 88, "Comedy")
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantTitles []string
+	}{
+		{"default sort", "/v1/movies", http.StatusOK, []string{"Airplane!", "Alien", "Moon"}},
+		{"sort by year descending", "/v1/movies?sort=-year", http.StatusOK, []string{"Moon", "Airplane!", "Alien"}},
+		{"filter by genre", "/v1/movies?genres=sci-fi", http.StatusOK, []string{"Alien", "Moon"}},
+		{"filter by title", "/v1/movies?title=moon", http.StatusOK, []string{"Moon"}},
+		{"second page", "/v1/movies?page=2&page-size=2", http.StatusOK, []string{"Moon"}},
+		{"past the last page", "/v1/movies?page=3&page-size=2", http.StatusOK, []string{}},
+		{"unknown sort", "/v1/movies?sort=director", http.StatusUnprocessableEntity, nil},
+		{"invalid page", "/v1/movies?page=0", http.StatusUnprocessableEntity, nil},
+		{"non-numeric page size", "/v1/movies?page-size=all", http.StatusUnprocessableEntity, nil},
+		{"invalid country", "/v1/movies?country=GBR", http.StatusUnprocessableEntity, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := send(t, routes, http.MethodGet, tt.target, "", nil)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d; want %d (body %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			if tt.wantTitles == nil {
+				return
+			}
+
+			movies := decodeEnvelope(t, rr)["movies"].([]any)
+
+			if len(movies) != len(tt.wantTitles) {
+				t.Fatalf("got %d movies; want %d", len(movies), len(tt.wantTitles))
+			}
+
+			for i, movie := range movies {
+				if title := movie.(map[string]any)["title"]; title != tt.wantTitles[i] {
+					t.Errorf("got title %v at %d; want %q", title, i, tt.wantTitles[i])
+				}
+			}
+		})
+	}
+}
+
+// A genre can be given a slug which isn't the slug of its name, so movies with it
+// must be found by its name as well as its slug.
+func TestCustomSlugGenre(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	err := app.models.Genres.Insert(context.Background(), &data.Genre{Slug: "noir", Name: "Film Noir"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insertTestMovie(t, app, "Chinatown", 1974, 130, "film noir", "Drama")
+	insertTestMovie(t, app, "Heat", 1995, 170, "Action", "Drama")
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"filter by name", http.MethodGet, "/v1/movies?genres=Film%20Noir", "", http.StatusOK, `"title":"Chinatown"`},
+		{"filter by slug", http.MethodGet, "/v1/movies?genres=noir", "", http.StatusOK, `"title":"Chinatown"`},
+		{"update the title only", http.MethodPatch, "/v1/movies/1", `{"title": "Chinatown (1974)"}`, http.StatusOK, `"genres":["Film Noir","Drama"]`},
+		{"duplicate by name and slug", http.MethodPatch, "/v1/movies/1", `{"genres": ["Film Noir", "noir"]}`, http.StatusUnprocessableEntity, `"genres":"must not contain duplicates"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := send(t, routes, tt.method, tt.target, tt.body, nil)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d; want %d (body %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			var body bytes.Buffer
+
+			json.Compact(&body, rr.Body.Bytes())
+
+			if !strings.Contains(body.String(), tt.wantBody) {
+				t.Errorf("got body %s; want it to contain %s", body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestGetMergedMovie(t *testing.T) {
+	app := newTestApplication(t)
+
+	insertTestMovie(t, app, "Moon", 2009, 97, "Drama", "Sci-Fi")
+	insertTestMovie(t, app, "Moon.", 2009, 97, "Drama", "Sci-Fi")
+
+	_, err := app.models.Movies.Merge(context.Background(), 2, 1, data.Editor{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := send(t, app.routes(), http.MethodGet, "/v1/movies/2?include=credits", "", nil)
+
+	if rr.Code != http.StatusMovedPermanently {
+		t.Fatalf("got status %d; want %d (body %s)", rr.Code, http.StatusMovedPermanently, rr.Body.String())
+	}
+
+	if got, want := rr.Header().Get("Location"), "/v1/movies/1?include=credits"; got != want {
+		t.Errorf("got Location header %q; want %q", got, want)
+	}
+
+	// The target changed, so its version was bumped.
+	movie, err := app.models.Movies.Get(context.Background(), 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if movie.Version != 2 {
+		t.Errorf("got target version %d; want 2", movie.Version)
+	}
+}
+
+func TestListSimilarMovies(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	insertTestMovie(t, app, "Moon", 2009, 97, "Drama", "Sci-Fi")
+	insertTestMovie(t, app, "Gravity", 2013, 91, "Drama", "Sci-Fi")
+	insertTestMovie(t, app, "Airplane!", 1980, 88, "Comedy")
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{"default limit", "/v1/movies/1/similar", http.StatusOK},
+		{"limit too small", "/v1/movies/1/similar?limit=0", http.StatusUnprocessableEntity},
+		{"limit too large", "/v1/movies/1/similar?limit=1000", http.StatusUnprocessableEntity},
+		{"missing movie", "/v1/movies/99/similar", http.StatusNotFound},
+		{"invalid id", "/v1/movies/abc/similar", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := send(t, routes, http.MethodGet, tt.target, "", nil)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d; want %d (body %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
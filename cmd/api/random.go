@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// Seeds are less than 2^53, whether the client sends one or not. Seeds are returned
+// in the response, and JSON numbers above 2^53 lose precision in JavaScript.
+const maxRandomSeed = 1 << 53
+
+// The randomMoviesHandler picks count movies at random from those matching the
+// title, genres and country parameters of listMoviesHandler and the year and
+// runtime ranges. The seed used is returned, so that sending it back picks the same
+// movies again.
+func (app *application) randomMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.RandomFilters
+		Count int
+		Seed  uint64
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Title = app.readString(qs, "title", "")
+	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.Country = strings.ToUpper(app.readString(qs, "country", ""))
+	input.MinYear = int32(app.readInt(qs, "min-year", 0, v))
+	input.MaxYear = int32(app.readInt(qs, "max-year", 0, v))
+	input.MinRuntime = int32(app.readInt(qs, "min-runtime", 0, v))
+	input.MaxRuntime = int32(app.readInt(qs, "max-runtime", 0, v))
+	input.Count = app.readInt(qs, "count", 1, v)
+	input.Seed = rand.Uint64N(maxRandomSeed)
+
+	if s := qs.Get("seed"); s != "" {
+		seed, err := strconv.ParseUint(s, 10, 64)
+
+		if err != nil {
+			v.AddError("seed", "must be a non-negative integer")
+		} else {
+			v.Check(seed < maxRandomSeed, "seed", fmt.Sprintf("must be less than %d", uint64(maxRandomSeed)))
+		}
+
+		input.Seed = seed
+	}
+
+	if input.Country != "" {
+		v.Check(validator.Matches(input.Country, data.CountryRX), "country", "must be a two letter country code like GB")
+	}
+
+	v.Check(input.Count > 0, "count", "must be greater than 0")
+	v.Check(input.Count <= 20, "count", "must not be more than 20")
+
+	if data.ValidateRandomFilters(v, input.RandomFilters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, err := app.models.Movies.GetRandom(r.Context(), input.RandomFilters, input.Count, input.Seed)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	e := envelope{
+		"movies": movies,
+		"seed":   input.Seed,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, e, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// The listRelatedMoviesHandler returns the movies related to a movie, like its
+// sequels and remakes, along with the type of each relation.
+func (app *application) listRelatedMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.requireMovie(w, r, id) {
+		return
+	}
+
+	related, err := app.models.Relations.GetRelated(r.Context(), id)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"related": related}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createMovieRelationHandler relates another movie to a movie. The inverse
+// relation is added to the other movie at the same time.
+func (app *application) createMovieRelationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		RelatedMovieID int64  `json:"related_movie_id"`
+		Type           string `json:"type"`
+	}
+
+	err = app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	relation := &data.Relation{
+		MovieID:        id,
+		RelatedMovieID: input.RelatedMovieID,
+		Type:           input.Type,
+	}
+
+	v := validator.New()
+
+	if data.ValidateRelation(v, relation); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireMovie(w, r, id) {
+		return
+	}
+
+	err = app.models.Relations.Insert(r.Context(), relation)
+
+	if err != nil {
+		switch {
+		// The movie was checked above, so a missing record here is the related movie.
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("related_movie_id", "must refer to an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateRelation):
+			v.AddError("related_movie_id", "is already related to this movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"relation": relation}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteMovieRelationHandler removes the relation between two movies, from
+// both sides.
+func (app *application) deleteMovieRelationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	relatedID, err := app.readMovieIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Relations.Delete(r.Context(), id, relatedID)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusNoContent, nil, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// The sort options shared by the review listings.
+var reviewSortSafeList = []string{"created_at", "updated_at", "-created_at", "-updated_at"}
+
+// The listMovieReviewsHandler lists the approved reviews of a movie, together with
+// any reviews of the movie by the authenticated user. Other statuses can only be
+// listed by moderators.
+func (app *application) listMovieReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+		Status string
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", data.ReviewApproved)
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page-size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-created_at")
+	input.SortSafeList = reviewSortSafeList
+
+	data.ValidateReviewStatus(v, input.Status)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// The anonymous user has an id of 0, which doesn't match the author of any
+	// review.
+	authorID := user.ID
+
+	if input.Status != data.ReviewApproved {
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(data.PermissionReviewsModerate) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		// Moderators filtering by status only want reviews with that status.
+		authorID = 0
+	}
+
+	if !app.requireMovie(w, r, id) {
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAll(r.Context(), id, input.Status, authorID, input.Filters)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	e := envelope{
+		"metadata": metadata,
+		"reviews":  reviews,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, e, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listReviewsHandler is the moderation queue. It lists the reviews of every
+// movie with the given status, which defaults to pending.
+func (app *application) listReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+		Status string
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", data.ReviewPending)
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page-size", 20, v)
+	input.Sort = app.readString(qs, "sort", "created_at")
+	input.SortSafeList = reviewSortSafeList
+
+	data.ValidateReviewStatus(v, input.Status)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAll(r.Context(), 0, input.Status, 0, input.Filters)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	e := envelope{
+		"metadata": metadata,
+		"reviews":  reviews,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, e, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createMovieReviewHandler adds a review of a movie by the authenticated user.
+// New reviews are pending until a moderator approves them.
+func (app *application) createMovieReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title string `json:"title"`
+		Body  string `json:"body"`
+	}
+
+	err = app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	review := &data.Review{
+		MovieID: id,
+		UserID:  app.contextGetUser(r).ID,
+		Title:   input.Title,
+		Body:    input.Body,
+		Status:  data.ReviewPending,
+	}
+
+	v := validator.New()
+
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Insert(r.Context(), review)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateReview):
+			v.AddError("review", "you have already reviewed this movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/reviews/%v", review.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"review": review}, headers)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The updateReviewHandler lets the author of a review change its title and body.
+// The edited review goes back to pending, so that it is moderated again. Other
+// users get a 404, as if the review didn't exist.
+func (app *application) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := app.models.Reviews.Get(r.Context(), id)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	// Another user's review is reported as missing, like a private list, so that
+	// pending and rejected reviews can't be found by guessing ids.
+	if review.UserID != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title *string `json:"title"`
+		Body  *string `json:"body"`
+	}
+
+	err = app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Title != nil {
+		review.Title = *input.Title
+	}
+
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+
+	review.Status = data.ReviewPending
+
+	v := validator.New()
+
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Update(r.Context(), review)
+
+	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"review": review}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteReviewHandler lets the author of a review delete it.
+func (app *application) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := app.models.Reviews.Get(r.Context(), id)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	if review.UserID != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Reviews.Delete(r.Context(), review.ID)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusNoContent, nil, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The moderateReviewHandler sets the moderation status of a review.
+func (app *application) moderateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := app.models.Reviews.Get(r.Context(), id)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+
+	err = app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateReviewStatus(v, input.Status); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	review.Status = input.Status
+
+	err = app.models.Reviews.Update(r.Context(), review)
+
+	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"review": review}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
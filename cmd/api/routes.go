@@ -2,13 +2,16 @@ package main
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
 )
 
 func (app *application) routes() http.Handler {
-	// Initialize a new httprouter router instance
-	router := httprouter.New()
+	// Initialize a new httprouter router instance, which records the route each
+	// request matched.
+	router := patternRouter{Router: httprouter.New(), app: app}
 
 	// Convert the notfoundresponse to a http.Handler using
 	// http.HandlerFunc adapter and then set it as the custom error handler for 404
@@ -19,8 +22,20 @@ func (app *application) routes() http.Handler {
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.createMovieHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.getMovieByIdHandler)
+
+	// POST routes which create or change records are wrapped with the idempotent
+	// middleware, so that clients can safely retry them with an Idempotency-Key.
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.idempotent(app.createMovieHandler))
+
+	// Fixed segments like /v1/movies/export share their position with the :id
+	// parameter, so they are dispatched through routeSegments().
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.routeSegments("id", map[string]http.HandlerFunc{
+		"export": app.exportMoviesHandler,
+		"lookup": app.lookupMovieHandler,
+		"random": app.randomMoviesHandler,
+		"stats":  app.movieStatsHandler,
+	}, app.getMovieByIdHandler))
+
 	// router.HandlerFunc(http.MethodPut, "/v1/movies/:id", app.updateMovieHandler)
 
 	// We change the allowed HTTP verb to patch since we are performing a partial update
@@ -29,8 +44,160 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.deleteMovieHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.listMoviesHandler)
 
+	// The revert route below puts an :id parameter in the POST tree too, so
+	// /v1/movies/batch and /v1/movies/import are dispatched in the same way.
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.routeSegments("id", map[string]http.HandlerFunc{
+		"batch": app.idempotent(app.createMoviesBatchHandler),
+		// The import body is an upload of up to 100MB, so it isn't buffered to
+		// fingerprint it. Importing is limited to users with the movies:import
+		// permission, like the other bulk and admin writes.
+		"import": app.requirePermission(data.PermissionMoviesImport, app.importMoviesHandler),
+	}, app.methodNotAllowedResponse))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.listMovieRevisionsHandler)
+	// Reverting is recorded as a revision like any other change to a movie, so like
+	// them it records the authenticated user, if any, as the acting user.
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:version/revert", app.idempotent(app.revertMovieHandler))
+
+	// Anyone can read the credits and people, but changing them requires the
+	// catalogue:write permission.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.listMovieCreditsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.requirePermission(data.PermissionCatalogueWrite, app.idempotent(app.createMovieCreditHandler)))
+
+	// A user can only set and delete their own rating, so there is no user id in the
+	// URL. PUT replaces the rating, which makes retrying it safe without a key.
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/rating", app.requireAuthenticatedUser(app.setMovieRatingHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/rating", app.requireAuthenticatedUser(app.deleteMovieRatingHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/related", app.listRelatedMoviesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/similar", app.listSimilarMoviesHandler)
+	// Relating movies to each other requires the catalogue:write permission.
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/related", app.requirePermission(data.PermissionCatalogueWrite, app.idempotent(app.createMovieRelationHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/related/:movie_id", app.requirePermission(data.PermissionCatalogueWrite, app.deleteMovieRelationHandler))
+
+	// External ids, translations and releases are keyed by source, locale and
+	// country, so PUT creates or replaces them and is safe to retry without an
+	// idempotency key. Changing them requires the catalogue:write permission,
+	// since external ids are also used to find duplicate movies.
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/external_ids/:source", app.requirePermission(data.PermissionCatalogueWrite, app.putMovieExternalIDHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/external_ids/:source", app.requirePermission(data.PermissionCatalogueWrite, app.deleteMovieExternalIDHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/translations", app.listMovieTranslationsHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/translations/:locale", app.requirePermission(data.PermissionCatalogueWrite, app.putMovieTranslationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/translations/:locale", app.requirePermission(data.PermissionCatalogueWrite, app.deleteMovieTranslationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/releases", app.listMovieReleasesHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/releases/:country", app.requirePermission(data.PermissionCatalogueWrite, app.putMovieReleaseHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/releases/:country", app.requirePermission(data.PermissionCatalogueWrite, app.deleteMovieReleaseHandler))
+
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/poster", app.requireAuthenticatedUser(app.uploadMoviePosterHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/backdrop", app.requireAuthenticatedUser(app.uploadMovieBackdropHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/images/*filepath", app.serveImageHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.listMovieReviewsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requireAuthenticatedUser(app.idempotent(app.createMovieReviewHandler)))
+
+	// Finding and merging duplicate movies is limited to users with the
+	// movies:merge permission.
+	router.HandlerFunc(http.MethodGet, "/v1/admin/movies/duplicates", app.requirePermission(data.PermissionMoviesMerge, app.listDuplicateMoviesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/movies/:id/merge", app.requirePermission(data.PermissionMoviesMerge, app.idempotent(app.mergeMovieHandler)))
+
+	// Reviews can only be edited and deleted by their author, which the handlers
+	// check, and moderated by users with the reviews:moderate permission.
+	router.HandlerFunc(http.MethodGet, "/v1/reviews", app.requirePermission(data.PermissionReviewsModerate, app.listReviewsHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/reviews/:id", app.requireAuthenticatedUser(app.updateReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/reviews/:id", app.requireAuthenticatedUser(app.deleteReviewHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/reviews/:id/status", app.requirePermission(data.PermissionReviewsModerate, app.moderateReviewHandler))
+
+	// Anyone can read the collections, but changing them requires the
+	// catalogue:write permission.
+	router.HandlerFunc(http.MethodGet, "/v1/collections", app.listCollectionsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/collections", app.requirePermission(data.PermissionCatalogueWrite, app.idempotent(app.createCollectionHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/collections/:id", app.getCollectionByIdHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/collections/:id", app.requirePermission(data.PermissionCatalogueWrite, app.updateCollectionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:id", app.requirePermission(data.PermissionCatalogueWrite, app.deleteCollectionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/collections/:id/movies", app.requirePermission(data.PermissionCatalogueWrite, app.idempotent(app.addCollectionMovieHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/collections/:id/movies/:movie_id", app.requirePermission(data.PermissionCatalogueWrite, app.moveCollectionMovieHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:id/movies/:movie_id", app.requirePermission(data.PermissionCatalogueWrite, app.removeCollectionMovieHandler))
+
+	// Lists can only be changed by their owner, which the handlers check. Public
+	// lists can be fetched without authenticating.
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.requireAuthenticatedUser(app.listListsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.requireAuthenticatedUser(app.idempotent(app.createListHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.getListByIdHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id", app.requireAuthenticatedUser(app.updateListHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.requireAuthenticatedUser(app.deleteListHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists/:id/items", app.requireAuthenticatedUser(app.idempotent(app.addListItemHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id/items/:movie_id", app.requireAuthenticatedUser(app.moveListItemHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/items/:movie_id", app.requireAuthenticatedUser(app.removeListItemHandler))
+
+	// The /v1/me routes act on the authenticated user.
+	router.HandlerFunc(http.MethodPost, "/v1/me/watched", app.requireAuthenticatedUser(app.idempotent(app.recordWatchedHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/me/stats", app.requireAuthenticatedUser(app.showWatchStatsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.listPeopleHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermission(data.PermissionCatalogueWrite, app.idempotent(app.createPersonHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.getPersonByIdHandler)
+
+	// Anyone can read the genres, but changing them requires the genres:write
+	// permission.
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.listGenresHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/genres", app.requirePermission(data.PermissionGenresWrite, app.idempotent(app.createGenreHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:id", app.getGenreByIdHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/genres/:id", app.requirePermission(data.PermissionGenresWrite, app.updateGenreHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/genres/:id", app.requirePermission(data.PermissionGenresWrite, app.deleteGenreHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.idempotent(app.registerUserHandler))
+
+	// Authentication tokens aren't idempotent since replaying the response would mean
+	// storing the plaintext token.
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+
 	// We wrap our router with the panic recovery middleware.
 	// This will ensure that the middleware runs for every one of our API endpoints.
-	return app.recoverPanic(router)
+	// The authenticate middleware runs inside it so that panics in it are recovered
+	// too. The requestID and logRequest middleware run outside it, so that the
+	// request-scoped logger is available when a panic is logged and the 500 response
+	// is recorded in the request log. The traceRequest middleware runs between them,
+	// so that the span has the request ID and the logger has the trace ID.
+	return app.requestID(app.traceRequest(app.logRequest(app.recoverPanic(app.authenticate(router)))))
 	// return router
 }
+
+// httprouter doesn't allow a fixed path segment in the same position as a named
+// parameter for the same HTTP method (e.g. /v1/movies/batch alongside /v1/movies/:id),
+// so we register the parameterised route and use routeSegments() to dispatch to the
+// handler for a fixed segment. Any other value is passed to the fallback handler.
+func (app *application) routeSegments(param string, handlers map[string]http.HandlerFunc, fallback http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		segment := params.ByName(param)
+
+		handler, ok := handlers[segment]
+
+		if ok {
+			app.contextSaveRoute(r, strings.Replace(app.contextGetRoute(r), ":"+param, segment, 1))
+		} else {
+			handler = fallback
+		}
+
+		handler(w, r)
+	}
+}
+
+// A patternRouter is a httprouter.Router which records the pattern of the route
+// matching each request, like "/v1/movies/:id/reviews", with contextSaveRoute(), so
+// that requests for different records are logged and traced under the same route.
+// Newer versions of httprouter can do this with the SaveMatchedRoutePath option,
+// but only in the params of the handler, which the middleware running outside the
+// router can't see.
+type patternRouter struct {
+	*httprouter.Router
+	app *application
+}
+
+func (pr patternRouter) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	pr.Router.HandlerFunc(method, path, func(w http.ResponseWriter, r *http.Request) {
+		pr.app.contextSaveRoute(r, path)
+		handler(w, r)
+	})
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRoutes makes a request to every route and checks the status code and part of
+// the response body. Movies and genres are kept in memory, so their routes are
+// tested all the way through, including the successful paths. The other routes are
+// tested on the paths which fail before they reach the database, like
+// authentication, invalid ids and validation failures. Every case gets its own
+// application with the same two movies, Moon and Alien, so the cases don't depend
+// on each other.
+// Sequences of requests which do are tested in TestMovieLifecycle.
+func TestRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		// wantBody is part of the response body, which is compacted first when it is
+		// JSON.
+		wantBody string
+	}{
+		{"healthcheck", http.MethodGet, "/v1/healthcheck", "", http.StatusOK, `"status":"available"`},
+
+		{"create movie", http.MethodPost, "/v1/movies", `{"title": "Solaris", "year": 1972, "runtime": "167 mins", "genres": ["sci-fi"]}`, http.StatusCreated, `"title":"Solaris","year":1972,"runtime":"167 mins","genres":["Sci-Fi"],"version":1`},
+		{"get movie", http.MethodGet, "/v1/movies/1", "", http.StatusOK, `"title":"Moon","year":2009,"runtime":"97 mins","genres":["Drama","Sci-Fi"]`},
+		{"get missing movie", http.MethodGet, "/v1/movies/99", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"export movies", http.MethodGet, "/v1/movies/export", "", http.StatusOK, "Moon,2009,97 mins,Drama|Sci-Fi,1\n"},
+		{"lookup movie without source", http.MethodGet, "/v1/movies/lookup", "", http.StatusUnprocessableEntity, `"source":"must be provided"`},
+		{"random movies", http.MethodGet, "/v1/movies/random", "", http.StatusOK, `"seed":`},
+		{"random movies with too large a seed", http.MethodGet, "/v1/movies/random?seed=9007199254740992", "", http.StatusUnprocessableEntity, `"seed":"must be less than 9007199254740992"`},
+		{"movie stats", http.MethodGet, "/v1/movies/stats", "", http.StatusOK, `"total_movies":2`},
+		{"update movie", http.MethodPatch, "/v1/movies/1", `{"title": "Moon (2009)"}`, http.StatusOK, `"title":"Moon (2009)"`},
+		{"delete missing movie", http.MethodDelete, "/v1/movies/99", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"list movies", http.MethodGet, "/v1/movies", "", http.StatusOK, `"total_records":2`},
+		{"create batch", http.MethodPost, "/v1/movies/batch", `[{"title": "Up", "year": 2009, "runtime": "96 mins", "genres": ["comedy"]}, {"title": ""}]`, http.StatusCreated, `"created":1,"failed":1`},
+		{"delete movie", http.MethodDelete, "/v1/movies/1", "", http.StatusNoContent, ""},
+		{"create empty batch", http.MethodPost, "/v1/movies/batch", `[]`, http.StatusUnprocessableEntity, `"movies":"must contain at least 1 movie"`},
+		{"import anonymously", http.MethodPost, "/v1/movies/import", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"post to movie", http.MethodPost, "/v1/movies/1", "", http.StatusMethodNotAllowed, `"error":"The POST method is not supported for this resource"`},
+
+		{"list revisions of invalid id", http.MethodGet, "/v1/movies/abc/revisions", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"revert invalid version", http.MethodPost, "/v1/movies/1/revisions/abc/revert", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+
+		{"list credits of missing movie", http.MethodGet, "/v1/movies/99/credits", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"create credit anonymously", http.MethodPost, "/v1/movies/1/credits", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+
+		{"set rating anonymously", http.MethodPut, "/v1/movies/1/rating", `{"rating": 8}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"delete rating anonymously", http.MethodDelete, "/v1/movies/1/rating", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+
+		{"list related of missing movie", http.MethodGet, "/v1/movies/99/related", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"list similar movies", http.MethodGet, "/v1/movies/1/similar", "", http.StatusOK, `"score":`},
+		{"list similar with invalid limit", http.MethodGet, "/v1/movies/1/similar?limit=0", "", http.StatusUnprocessableEntity, `"limit":"must be greater than 0"`},
+		{"create relation anonymously", http.MethodPost, "/v1/movies/1/related", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"delete relation anonymously", http.MethodDelete, "/v1/movies/1/related/2", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+
+		{"put external id anonymously", http.MethodPut, "/v1/movies/1/external_ids/imdb", `{"id": "nope"}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"delete external id anonymously", http.MethodDelete, "/v1/movies/1/external_ids/imdb", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"list translations of missing movie", http.MethodGet, "/v1/movies/99/translations", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"put translation anonymously", http.MethodPut, "/v1/movies/1/translations/fr", `{"title": ""}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"delete translation anonymously", http.MethodDelete, "/v1/movies/1/translations/fr", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"list releases of missing movie", http.MethodGet, "/v1/movies/99/releases", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"put release anonymously", http.MethodPut, "/v1/movies/1/releases/GB", `{"date": "yesterday"}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"delete release anonymously", http.MethodDelete, "/v1/movies/1/releases/GB", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+
+		{"upload poster anonymously", http.MethodPut, "/v1/movies/1/poster", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"upload backdrop anonymously", http.MethodPut, "/v1/movies/1/backdrop", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"serve missing image", http.MethodGet, "/v1/images/movies/1/poster/abc/small", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+
+		{"list reviews of invalid id", http.MethodGet, "/v1/movies/abc/reviews", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"create review anonymously", http.MethodPost, "/v1/movies/1/reviews", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+
+		{"list duplicates anonymously", http.MethodGet, "/v1/admin/movies/duplicates", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"merge anonymously", http.MethodPost, "/v1/admin/movies/1/merge", `{"into_movie_id": 2}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+
+		{"list all reviews anonymously", http.MethodGet, "/v1/reviews", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"update review anonymously", http.MethodPatch, "/v1/reviews/1", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"delete review anonymously", http.MethodDelete, "/v1/reviews/1", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"moderate review anonymously", http.MethodPut, "/v1/reviews/1/status", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+
+		{"list collections with invalid page", http.MethodGet, "/v1/collections?page=0", "", http.StatusUnprocessableEntity, `"page":"must be greater than 0"`},
+		{"create collection anonymously", http.MethodPost, "/v1/collections", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"get collection with invalid id", http.MethodGet, "/v1/collections/abc", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"update collection anonymously", http.MethodPatch, "/v1/collections/1", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"delete collection anonymously", http.MethodDelete, "/v1/collections/1", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"add collection movie anonymously", http.MethodPost, "/v1/collections/1/movies", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"move collection movie anonymously", http.MethodPatch, "/v1/collections/1/movies/1", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"remove collection movie anonymously", http.MethodDelete, "/v1/collections/1/movies/1", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+
+		{"list lists anonymously", http.MethodGet, "/v1/lists", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"create list anonymously", http.MethodPost, "/v1/lists", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"get list with invalid id", http.MethodGet, "/v1/lists/abc", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"update list anonymously", http.MethodPatch, "/v1/lists/1", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"delete list anonymously", http.MethodDelete, "/v1/lists/1", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"add list item anonymously", http.MethodPost, "/v1/lists/1/items", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"move list item anonymously", http.MethodPatch, "/v1/lists/1/items/1", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"remove list item anonymously", http.MethodDelete, "/v1/lists/1/items/1", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+
+		{"record watched anonymously", http.MethodPost, "/v1/me/watched", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"show watch stats anonymously", http.MethodGet, "/v1/me/stats", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+
+		{"list people with invalid sort", http.MethodGet, "/v1/people?sort=age", "", http.StatusUnprocessableEntity, `"sort":"invalid sort value"`},
+		{"create person anonymously", http.MethodPost, "/v1/people", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"get person with invalid id", http.MethodGet, "/v1/people/abc", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+
+		{"list genres", http.MethodGet, "/v1/genres", "", http.StatusOK, `"slug":"sci-fi","name":"Sci-Fi"`},
+		{"create genre anonymously", http.MethodPost, "/v1/genres", `{"name": "Horror"}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"get genre", http.MethodGet, "/v1/genres/1", "", http.StatusOK, `"genre":{"id":1,"slug":"action","name":"Action","version":1}`},
+		{"get missing genre", http.MethodGet, "/v1/genres/99", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"update genre anonymously", http.MethodPatch, "/v1/genres/1", `{}`, http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+		{"delete genre anonymously", http.MethodDelete, "/v1/genres/1", "", http.StatusUnauthorized, `"error":"you must be authenticated to access this resource"`},
+
+		{"register invalid user", http.MethodPost, "/v1/users", `{"email": "nope", "password": "pa55word1234"}`, http.StatusUnprocessableEntity, `"email":"must be a valid email address"`},
+		{"create token with invalid email", http.MethodPost, "/v1/tokens/authentication", `{"email": "nope", "password": "pa55word1234"}`, http.StatusUnprocessableEntity, `"email":"must be a valid email address"`},
+
+		{"unknown route", http.MethodGet, "/v2/movies", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"unsupported method", http.MethodPut, "/v1/healthcheck", "", http.StatusMethodNotAllowed, `"error":"The PUT method is not supported for this resource"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			insertTestMovie(t, app, "Moon", 2009, 97, "Drama", "Sci-Fi")
+			insertTestMovie(t, app, "Alien", 1979, 117, "Sci-Fi")
+
+			rr := send(t, app.routes(), tt.method, tt.target, tt.body, nil)
+
+			checkResponse(t, rr, tt.wantStatus, tt.wantBody)
+		})
+	}
+}
+
+// TestMovieLifecycle creates, reads and deletes movies in order, so each step
+// depends on the ones before it.
+func TestMovieLifecycle(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	steps := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"create movie", http.MethodPost, "/v1/movies", `{"title": "Moon", "year": 2009, "runtime": "97 mins", "genres": ["drama", "sci-fi"]}`, http.StatusCreated, `"id":1,`},
+		{"create batch", http.MethodPost, "/v1/movies/batch", `[{"title": "Up", "year": 2009, "runtime": "96 mins", "genres": ["comedy"]}]`, http.StatusCreated, `"created":1,"failed":0`},
+		{"get batch movie", http.MethodGet, "/v1/movies/2", "", http.StatusOK, `"title":"Up","year":2009,"runtime":"96 mins","genres":["Comedy"]`},
+		{"list movies", http.MethodGet, "/v1/movies", "", http.StatusOK, `"total_records":2`},
+		{"delete movie", http.MethodDelete, "/v1/movies/2", "", http.StatusNoContent, ""},
+		{"get deleted movie", http.MethodGet, "/v1/movies/2", "", http.StatusNotFound, `"error":"The requested resource could not be found"`},
+		{"list remaining movies", http.MethodGet, "/v1/movies", "", http.StatusOK, `"total_records":1`},
+	}
+
+	for _, step := range steps {
+		ok := t.Run(step.name, func(t *testing.T) {
+			rr := send(t, routes, step.method, step.target, step.body, nil)
+
+			checkResponse(t, rr, step.wantStatus, step.wantBody)
+		})
+
+		// The later steps would only fail with confusing errors.
+		if !ok {
+			return
+		}
+	}
+}
+
+// checkResponse checks the status of a response and that its body, which is
+// compacted first when it is JSON, contains wantBody.
+func checkResponse(t *testing.T, rr *httptest.ResponseRecorder, wantStatus int, wantBody string) {
+	t.Helper()
+
+	if rr.Code != wantStatus {
+		t.Errorf("got status %d; want %d (body %s)", rr.Code, wantStatus, rr.Body.String())
+	}
+
+	body := rr.Body.String()
+
+	var compact bytes.Buffer
+
+	if json.Compact(&compact, rr.Body.Bytes()) == nil {
+		body = compact.String()
+	}
+
+	if !strings.Contains(body, wantBody) {
+		t.Errorf("got body %s; want it to contain %s", body, wantBody)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := send(t, app.routes(), http.MethodPut, "/v1/healthcheck", "", nil)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+
+	if got := rr.Header().Get("Allow"); got != "GET, OPTIONS" {
+		t.Errorf("got Allow header %q; want %q", got, "GET, OPTIONS")
+	}
+
+	e := decodeEnvelope(t, rr)
+
+	if want := "The PUT method is not supported for this resource"; e["error"] != want {
+		t.Errorf("got error %q; want %q", e["error"], want)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// The serve() method starts the HTTP server and blocks until it has shut down. On
+// SIGINT or SIGTERM the server stops accepting connections and waits up to 30
+// seconds for the requests in progress to finish, and then the spans recorded for
+// them are written out.
+func (app *application) serve() error {
+	// Declare a HTTP server which listens on the port provided in the config struct, uses
+	// the servemux we created above as the handler, has some sensible timeout settings
+	// and writes any log messages to the structured logger at Error level.
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Handler:      app.routes(),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+	}
+
+	// Shutdown() makes ListenAndServe() return straight away, so the result of the
+	// shutdown is passed back on this channel once it is complete.
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+		s := <-quit
+
+		app.logger.Info("shutting down server", "signal", s.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		// The tracer is shut down after the server, so that the spans of the requests
+		// which were still in progress are written too.
+		shutdownError <- errors.Join(server.Shutdown(ctx), app.tracer.Shutdown(ctx))
+	}()
+
+	// Start the HTTP server
+	app.logger.Info(fmt.Sprintf("Starting server %v %v", server.Addr, app.config.env))
+
+	err := server.ListenAndServe()
+
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("stopped server", "addr", server.Addr)
+
+	return nil
+}
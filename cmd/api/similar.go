@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// The listSimilarMoviesHandler recommends movies similar to a movie, based on their
+// genres, year and runtime. The weight of each is set with the -similar-* flags.
+// Only movies sharing a genre are recommended, so a movie without genres gets an
+// empty list.
+func (app *application) listSimilarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	limit := app.readInt(r.URL.Query(), "limit", 10, v)
+
+	v.Check(limit > 0, "limit", "must be greater than 0")
+	v.Check(limit <= 50, "limit", "must not be more than 50")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireMovie(w, r, id) {
+		return
+	}
+
+	similar, err := app.models.Movies.GetSimilar(r.Context(), id, app.config.similarity, limit)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"similar": similar}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
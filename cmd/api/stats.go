@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// The movieStatsHandler returns statistics for the movies matching the same title,
+// genres and country parameters as listMoviesHandler. The statistics are cached
+// for the -stats-cache-ttl duration, so they can lag behind recent changes.
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title   string
+		Genres  []string
+		Country string
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Title = app.readString(qs, "title", "")
+	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.Country = strings.ToUpper(app.readString(qs, "country", ""))
+
+	if input.Country != "" {
+		v.Check(validator.Matches(input.Country, data.CountryRX), "country", "must be a two letter country code like GB")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Titles and genre names are matched ignoring case, so the key is built from the
+	// lowercased title and the sorted, distinct lowercased genre names, to share
+	// entries between requests which match the same movies. Names with the same slug
+	// can find different genres, so the key can't use the slugs.
+	genres := make([]string, len(input.Genres))
+
+	for i, genre := range input.Genres {
+		genres[i] = strings.ToLower(genre)
+	}
+
+	slices.Sort(genres)
+
+	key := fmt.Sprintf("%q %q %q", strings.ToLower(input.Title), slices.Compact(genres), input.Country)
+
+	stats, err := app.movieStats.getOrLoad(r.Context(), key, app.config.statsCacheTTL, func(ctx context.Context) (*data.MovieStats, error) {
+		return app.models.Movies.GetStats(ctx, input.Title, input.Genres, input.Country)
+	})
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
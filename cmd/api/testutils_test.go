@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/storage"
+)
+
+// newTestApplication returns an application which keeps its movies and genres in
+// memory, so that the handlers can be tested without a database. The other models
+// have no database, so tests must only take the paths through their handlers which
+// don't reach them, like validation failures.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	store, err := storage.NewLocal(t.TempDir(), "/v1/images")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genres := data.NewMemoryGenres("Action", "Comedy", "Drama", "Sci-Fi")
+
+	var cfg config
+	cfg.env = "testing"
+	cfg.similarity = data.SimilarityWeights{Genres: 0.6, Year: 0.25, Runtime: 0.15}
+
+	return &application{
+		config: cfg,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		models: data.Models{
+			Genres: genres,
+			Movies: data.NewMemoryMovies(genres),
+		},
+		storage: store,
+	}
+}
+
+// insertTestMovie adds a movie to the application's movie repository and returns
+// it.
+func insertTestMovie(t *testing.T, app *application, title string, year int32, runtime data.Runtime, genres ...string) *data.Movie {
+	t.Helper()
+
+	movie := &data.Movie{
+		Title:   title,
+		Year:    year,
+		Runtime: runtime,
+		Genres:  genres,
+	}
+
+	err := app.models.Movies.Insert(context.Background(), movie, data.Editor{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return movie
+}
+
+// asUser returns a handler which calls next as an authenticated user, for testing
+// handlers which are wrapped in requirePermission() without going through it.
+func asUser(app *application, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next(w, app.contextSetUser(r, &data.User{ID: 1}))
+	})
+}
+
+// send makes a request to the handler and returns the recorded response. An empty
+// body sends no body at all.
+func send(t *testing.T, h http.Handler, method string, target string, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var r io.Reader
+
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+
+	req := httptest.NewRequest(method, target, r)
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// decodeEnvelope decodes a JSON response body into a map.
+func decodeEnvelope(t *testing.T, rr *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+
+	var e map[string]any
+
+	err := json.Unmarshal(rr.Body.Bytes(), &e)
+
+	if err != nil {
+		t.Fatalf("decoding response %q: %v", rr.Body.String(), err)
+	}
+
+	return e
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// The listMovieTranslationsHandler returns every translation of a movie's title
+// and overview.
+func (app *application) listMovieTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.requireMovie(w, r, id) {
+		return
+	}
+
+	translations, err := app.models.Translations.GetAllForMovie(r.Context(), id)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"translations": translations}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The putMovieTranslationHandler creates or replaces the translation of a movie into
+// the locale in the URL. Locales are case insensitive, so pt-BR and pt-br are the
+// same translation.
+func (app *application) putMovieTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title    string `json:"title"`
+		Overview string `json:"overview"`
+	}
+
+	err = app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	translation := &data.Translation{
+		MovieID:  id,
+		Locale:   data.NormalizeLocale(httprouter.ParamsFromContext(r.Context()).ByName("locale")),
+		Title:    input.Title,
+		Overview: input.Overview,
+	}
+
+	v := validator.New()
+
+	if data.ValidateTranslation(v, translation); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Translations.Upsert(r.Context(), translation)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"translation": translation}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMovieTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	locale := data.NormalizeLocale(httprouter.ParamsFromContext(r.Context()).ByName("locale"))
+
+	err = app.models.Translations.Delete(r.Context(), id, locale)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusNoContent, nil, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listMovieReleasesHandler returns the release date and certification of a
+// movie in each country, earliest first.
+func (app *application) listMovieReleasesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.requireMovie(w, r, id) {
+		return
+	}
+
+	releases, err := app.models.Releases.GetAllForMovie(r.Context(), id)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"releases": releases}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The putMovieReleaseHandler creates or replaces the release of a movie in the
+// country in the URL.
+func (app *application) putMovieReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Date          string `json:"date"`
+		Certification string `json:"certification"`
+	}
+
+	err = app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	release := &data.Release{
+		MovieID:       id,
+		Country:       strings.ToUpper(httprouter.ParamsFromContext(r.Context()).ByName("country")),
+		Date:          input.Date,
+		Certification: input.Certification,
+	}
+
+	v := validator.New()
+
+	if data.ValidateRelease(v, release); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Releases.Upsert(r.Context(), release)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"release": release}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMovieReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	country := strings.ToUpper(httprouter.ParamsFromContext(r.Context()).ByName("country"))
+
+	err = app.models.Releases.Delete(r.Context(), id, country)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusNoContent, nil, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
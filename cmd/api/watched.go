@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/data"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// The recordWatchedHandler adds a movie to the watch history of the authenticated
+// user. The watched_at time defaults to now, so that past viewings can be logged
+// too.
+func (app *application) recordWatchedHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MovieID   int64      `json:"movie_id"`
+		WatchedAt *time.Time `json:"watched_at"`
+	}
+
+	err := app.readJSON(r, &input)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	event := &data.WatchEvent{
+		UserID:    app.contextGetUser(r).ID,
+		MovieID:   input.MovieID,
+		WatchedAt: time.Now(),
+	}
+
+	if input.WatchedAt != nil {
+		event.WatchedAt = *input.WatchedAt
+	}
+
+	v := validator.New()
+
+	if data.ValidateWatchEvent(v, event); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.WatchHistory.Insert(r.Context(), event)
+
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("movie_id", "must refer to an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"watched": event}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showWatchStatsHandler returns the statistics computed from the watch history
+// of the authenticated user.
+func (app *application) showWatchStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.models.WatchHistory.GetStats(r.Context(), app.contextGetUser(r).ID)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
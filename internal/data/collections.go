@@ -0,0 +1,381 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// Define a custom ErrDuplicateCollectionMovie error for when a movie is added to a
+// collection which already contains it.
+var ErrDuplicateCollectionMovie = errors.New("duplicate collection movie")
+
+// A Collection groups movies which belong together, like the films of a franchise,
+// in a set order.
+type Collection struct {
+	ID          int64              `json:"id"`
+	CreatedAt   time.Time          `json:"-"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitzero"`
+	Version     int32              `json:"version"`
+	Movies      []*CollectionMovie `json:"movies,omitempty"`
+}
+
+// A CollectionMovie is a movie in a collection. Positions start at 1.
+type CollectionMovie struct {
+	MovieID  int64  `json:"movie_id"`
+	Title    string `json:"title"`
+	Year     int32  `json:"year,omitzero"`
+	Position int32  `json:"position"`
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(collection.Description) <= 2_000, "description", "must not be more than 2000 bytes long")
+}
+
+// The movies of each collection are ordered by their position.
+var collectionMovies = orderedMovies{parentTable: "collections", table: "collection_movies", parentColumn: "collection_id"}
+
+// Define a CollectionModel struct type which wraps a sql.DB connection pool. It
+// manages both collections and the movies in them.
+type CollectionModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+func (m CollectionModel) Insert(ctx context.Context, collection *Collection) error {
+	const query = `
+		INSERT INTO collections (
+			name,
+			description)
+		VALUES (
+			$1,
+			$2
+		)
+		RETURNING
+			id,
+			created_at,
+			version;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, collection.Name, collection.Description).Scan(&collection.ID, &collection.CreatedAt, &collection.Version)
+}
+
+// Get returns a collection along with its movies in order.
+func (m CollectionModel) Get(ctx context.Context, id int64) (*Collection, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	const query = `
+		SELECT
+			id,
+			created_at,
+			name,
+			description,
+			version
+		FROM
+			collections
+		WHERE
+			id = $1;`
+
+	var collection Collection
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.Name,
+		&collection.Description,
+		&collection.Version,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	const moviesQuery = `
+		SELECT
+			collection_movies.movie_id,
+			movies.title,
+			movies.year,
+			collection_movies.position
+		FROM
+			collection_movies
+		INNER JOIN
+			movies ON movies.id = collection_movies.movie_id
+		WHERE
+			collection_movies.collection_id = $1
+		ORDER BY
+			collection_movies.position ASC;`
+
+	rows, err := m.DB.QueryContext(ctx, moviesQuery, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	collection.Movies = []*CollectionMovie{}
+
+	for rows.Next() {
+		var movie CollectionMovie
+
+		err := rows.Scan(&movie.MovieID, &movie.Title, &movie.Year, &movie.Position)
+
+		if err != nil {
+			return nil, err
+		}
+
+		collection.Movies = append(collection.Movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &collection, nil
+}
+
+// GetAll returns a page of the collections whose name contains the given name,
+// ignoring case. The movies of each collection aren't included.
+func (m CollectionModel) GetAll(ctx context.Context, name string, filters Filters) ([]*Collection, *Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*) OVER(),
+			id,
+			created_at,
+			name,
+			description,
+			version
+		FROM
+			collections
+		WHERE
+			($1 = '' OR name ILIKE '%%' || $1 || '%%')
+		ORDER BY %v %v, id ASC
+		LIMIT $2
+		OFFSET $3;`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+
+	if err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	collections := []*Collection{}
+
+	totalRecords := 0
+
+	for rows.Next() {
+		var collection Collection
+
+		err := rows.Scan(
+			&totalRecords,
+			&collection.ID,
+			&collection.CreatedAt,
+			&collection.Name,
+			&collection.Description,
+			&collection.Version,
+		)
+
+		if err != nil {
+			return nil, &Metadata{}, err
+		}
+
+		collections = append(collections, &collection)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return collections, &metadata, nil
+}
+
+// Update saves the name and description of a collection using the same optimistic
+// locking as movies.
+func (m CollectionModel) Update(ctx context.Context, collection *Collection) error {
+	const query = `
+		UPDATE
+			collections
+		SET
+			name = $1,
+			description = $2,
+			version = version + 1
+		WHERE
+			id = $3
+		AND
+			version = $4
+		RETURNING
+			version;`
+
+	args := []any{collection.Name, collection.Description, collection.ID, collection.Version}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&collection.Version)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (m CollectionModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	const query = `
+		DELETE FROM
+			collections
+		WHERE
+			id = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AddMovie adds a movie to a collection at the given position, in the same way as
+// ListModel.AddItem(). ErrRecordNotFound is returned if the collection or the movie
+// doesn't exist, and ErrDuplicateCollectionMovie if the collection already
+// contains the movie.
+func (m CollectionModel) AddMovie(ctx context.Context, collectionID int64, movie *CollectionMovie) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	movie.Position, err = collectionMovies.insert(ctx, tx, collectionID, movie.MovieID, movie.Position, ErrDuplicateCollectionMovie)
+
+	if err != nil {
+		return err
+	}
+
+	err = getCollectionMovie(ctx, tx, movie)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MoveMovie moves a movie to a new position in a collection, in the same way as
+// ListModel.MoveItem().
+func (m CollectionModel) MoveMovie(ctx context.Context, collectionID int64, movie *CollectionMovie) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	movie.Position, err = collectionMovies.move(ctx, tx, collectionID, movie.MovieID, movie.Position)
+
+	if err != nil {
+		return err
+	}
+
+	err = getCollectionMovie(ctx, tx, movie)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveMovie removes a movie from a collection and closes the gap it leaves behind.
+// ErrRecordNotFound is returned if the collection doesn't contain the movie.
+func (m CollectionModel) RemoveMovie(ctx context.Context, collectionID int64, movieID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = collectionMovies.remove(ctx, tx, collectionID, movieID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// getCollectionMovie reads the title and year of a movie which has just been added
+// to or moved within a collection.
+func getCollectionMovie(ctx context.Context, tx *sql.Tx, movie *CollectionMovie) error {
+	const query = `
+		SELECT
+			title,
+			year
+		FROM
+			movies
+		WHERE
+			id = $1;`
+
+	return tx.QueryRowContext(ctx, query, movie.MovieID).Scan(&movie.Title, &movie.Year)
+}
@@ -0,0 +1,249 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/trace"
+)
+
+// NewConnector returns a connector for the PostgreSQL database at dsn which tags
+// every query with the ID of the request it was made for, by appending a comment
+// like /* request_id=... */. The comment shows up in pg_stat_activity and in the
+// server's statement and error logs, so they can be matched with our own logs.
+//
+// We don't use the application_name setting for this because it belongs to the
+// session, and a pooled connection is shared by many requests. The comment is put
+// at the end of the query rather than the start, because pq looks at the start of
+// a query to detect COPY statements.
+//
+// When tracer isn't nil every query is also recorded as a client span, which is a
+// child of the span in the context the query was run with.
+func NewConnector(dsn string, tracer *trace.Tracer) (driver.Connector, error) {
+	c, err := pq.NewConnector(dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return connector{Connector: c, tracer: tracer}, nil
+}
+
+type connector struct {
+	driver.Connector
+	tracer *trace.Tracer
+}
+
+// pqConn lists the optional driver interfaces that pq connections implement, so
+// that the wrapper keeps all of them.
+type pqConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dc, err := c.Connector.Connect(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pqc, ok := dc.(pqConn)
+
+	if !ok {
+		dc.Close()
+		return nil, errors.New("unexpected connection type from the postgres driver")
+	}
+
+	return conn{pqConn: pqc, tracer: c.tracer}, nil
+}
+
+type conn struct {
+	pqConn
+	tracer *trace.Tracer
+}
+
+func (c conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.pqConn.PrepareContext(ctx, tagQuery(ctx, query))
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	span := c.startSpan(ctx, query)
+	defer span.End()
+
+	result, err := c.pqConn.ExecContext(ctx, tagQuery(ctx, query), args)
+	err = contextError(ctx, err)
+
+	// ErrSkip tells database/sql to prepare the statement instead, which isn't a
+	// failure of the query.
+	if !errors.Is(err, driver.ErrSkip) {
+		span.SetError(err)
+		logQueryError(ctx, query, err)
+	}
+
+	return result, err
+}
+
+// The span of a query ends when the first rows have been received, rather than
+// when the rows are closed.
+func (c conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	span := c.startSpan(ctx, query)
+	defer span.End()
+
+	dr, err := c.pqConn.QueryContext(ctx, tagQuery(ctx, query), args)
+	err = contextError(ctx, err)
+
+	if !errors.Is(err, driver.ErrSkip) {
+		span.SetError(err)
+		logQueryError(ctx, query, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// A query can also be canceled while its rows are being read, so the errors of
+	// the rows are wrapped in the same way.
+	pqr, ok := dr.(pqRows)
+
+	if !ok {
+		return dr, nil
+	}
+
+	return rows{pqRows: pqr, ctx: ctx}, nil
+}
+
+// BeginTx begins a transaction whose Commit() and Rollback() errors are wrapped by
+// contextError(), since pq cancels the transaction when its context is canceled.
+func (c conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	dt, err := c.pqConn.BeginTx(ctx, opts)
+	err = contextError(ctx, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tx{Tx: dt, ctx: ctx}, nil
+}
+
+// pqRows lists the optional driver interfaces that pq rows implement, so that the
+// wrapper keeps all of them.
+type pqRows interface {
+	driver.Rows
+	driver.RowsNextResultSet
+	driver.RowsColumnTypeScanType
+	driver.RowsColumnTypeDatabaseTypeName
+	driver.RowsColumnTypeLength
+	driver.RowsColumnTypePrecisionScale
+}
+
+type rows struct {
+	pqRows
+	ctx context.Context
+}
+
+func (r rows) Next(dest []driver.Value) error {
+	// io.EOF marks the end of the rows rather than a failure, and database/sql
+	// checks for it with ==, so it must not be wrapped.
+	err := r.pqRows.Next(dest)
+
+	if err == io.EOF {
+		return err
+	}
+
+	return contextError(r.ctx, err)
+}
+
+func (r rows) NextResultSet() error {
+	err := r.pqRows.NextResultSet()
+
+	if err == io.EOF {
+		return err
+	}
+
+	return contextError(r.ctx, err)
+}
+
+type tx struct {
+	driver.Tx
+	ctx context.Context
+}
+
+func (t tx) Commit() error {
+	return contextError(t.ctx, t.Tx.Commit())
+}
+
+func (t tx) Rollback() error {
+	return contextError(t.ctx, t.Tx.Rollback())
+}
+
+// When a context is canceled pq asks the server to cancel the query, which then
+// fails with a "canceling statement due to user request" error that doesn't say
+// why. The contextError() helper wraps such errors with the error of the context,
+// so that callers can tell a client going away (context.Canceled) from a query
+// running out of time (context.DeadlineExceeded) with errors.Is(). The error can
+// come from running the query, reading its rows or ending its transaction, so it
+// is used for all three.
+func contextError(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, driver.ErrSkip) || ctx.Err() == nil || errors.Is(err, ctx.Err()) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", ctx.Err(), err)
+}
+
+// IsQueryCanceled reports whether err is PostgreSQL's query_canceled error (code
+// 57014), which a query fails with when it runs past the server's
+// statement_timeout or is canceled by another session. Cancellations caused by the
+// context are reported as context errors instead, by contextError().
+func IsQueryCanceled(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
+
+// The logQueryError() helper logs a failed query at debug level with the logger in
+// the context, so that the SQL behind an error response can be found by the request
+// ID the error is logged with. The error itself is still returned to the caller.
+func logQueryError(ctx context.Context, query string, err error) {
+	if err == nil {
+		return
+	}
+
+	LoggerFromContext(ctx).DebugContext(ctx, "query failed", "query", strings.Join(strings.Fields(query), " "), "error", err.Error())
+}
+
+// The startSpan() helper starts a span for a query, named after its SQL operation
+// like SELECT or UPDATE. Queries are only traced as part of a traced request, so
+// connection setup and background work don't start traces of their own.
+func (c conn) startSpan(ctx context.Context, query string) *trace.Span {
+	if trace.SpanFromContext(ctx) == nil {
+		return nil
+	}
+
+	operation := "QUERY"
+
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(strings.TrimRight(fields[0], ";"))
+	}
+
+	_, span := c.tracer.Start(ctx, operation, trace.SpanKindClient)
+
+	span.SetAttributes(
+		trace.Attribute{Key: "db.system", Value: "postgresql"},
+		trace.Attribute{Key: "db.operation.name", Value: operation},
+		trace.Attribute{Key: "db.query.text", Value: strings.TrimSpace(query)},
+	)
+
+	return span
+}
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+var errCanceledStatement = &pq.Error{Code: "57014", Message: "canceling statement due to user request"}
+
+func TestContextError(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want error
+	}{
+		{"no error", canceled, nil, nil},
+		{"context not done", context.Background(), errCanceledStatement, errCanceledStatement},
+		{"context canceled", canceled, errCanceledStatement, context.Canceled},
+		{"already the context error", canceled, context.Canceled, context.Canceled},
+		{"skip", canceled, driver.ErrSkip, driver.ErrSkip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := contextError(tt.ctx, tt.err)
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v; want an error matching %v", err, tt.want)
+			}
+
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("got %v; want it to still wrap %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRowsWrapErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := rows{pqRows: &fakeRows{err: errCanceledStatement}, ctx: ctx}
+
+	if err := r.Next(nil); !errors.Is(err, context.Canceled) || !IsQueryCanceled(err) {
+		t.Errorf("got %v; want the context error wrapping the pq error", err)
+	}
+
+	// The end of the rows isn't wrapped, since database/sql compares it with ==.
+	r = rows{pqRows: &fakeRows{err: io.EOF}, ctx: ctx}
+
+	if err := r.Next(nil); err != io.EOF {
+		t.Errorf("got %v; want io.EOF", err)
+	}
+}
+
+func TestTxWrapErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	tx := tx{Tx: fakeTx{err: errCanceledStatement}, ctx: ctx}
+
+	if err := tx.Commit(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v from Commit; want %v", err, context.DeadlineExceeded)
+	}
+
+	if err := tx.Rollback(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v from Rollback; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestIsQueryCanceled(t *testing.T) {
+	if !IsQueryCanceled(errCanceledStatement) {
+		t.Error("got false for query_canceled; want true")
+	}
+
+	if IsQueryCanceled(&pq.Error{Code: "23505"}) || IsQueryCanceled(errors.New("57014")) {
+		t.Error("got true for another error; want false")
+	}
+}
+
+type fakeRows struct {
+	err error
+}
+
+func (r *fakeRows) Columns() []string                                       { return nil }
+func (r *fakeRows) Close() error                                            { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error                          { return r.err }
+func (r *fakeRows) HasNextResultSet() bool                                  { return false }
+func (r *fakeRows) NextResultSet() error                                    { return io.EOF }
+func (r *fakeRows) ColumnTypeScanType(index int) reflect.Type               { return nil }
+func (r *fakeRows) ColumnTypeDatabaseTypeName(index int) string             { return "" }
+func (r *fakeRows) ColumnTypeLength(index int) (int64, bool)                { return 0, false }
+func (r *fakeRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) { return 0, 0, false }
+
+type fakeTx struct {
+	err error
+}
+
+func (t fakeTx) Commit() error   { return t.err }
+func (t fakeTx) Rollback() error { return t.err }
@@ -0,0 +1,184 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Define a custom ErrDuplicateExternalID error for when an external id is already
+// mapped to another movie.
+var ErrDuplicateExternalID = errors.New("duplicate external id")
+
+// ExternalIDs maps the source of each external id of a movie, like "imdb", to the
+// id of the movie in that catalogue.
+type ExternalIDs map[string]string
+
+// Scan implements the sql.Scanner interface for the JSONB object returned by the
+// movie_external_ids() function, which is NULL for a movie without external ids.
+func (e *ExternalIDs) Scan(src any) error {
+	if src == nil {
+		*e = nil
+		return nil
+	}
+
+	js, ok := src.([]byte)
+
+	if !ok {
+		return fmt.Errorf("cannot scan %T into ExternalIDs", src)
+	}
+
+	return json.Unmarshal(js, e)
+}
+
+// Define an ExternalIDModel struct type which wraps a sql.DB connection pool.
+type ExternalIDModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// GetMovieID returns the id of the movie which an external id is mapped to.
+// ErrRecordNotFound is returned if it isn't mapped to any movie.
+func (m ExternalIDModel) GetMovieID(ctx context.Context, source string, value string) (int64, error) {
+	const query = `
+		SELECT
+			movie_id
+		FROM
+			external_ids
+		WHERE
+			source = $1
+		AND
+			value = $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var movieID int64
+
+	err := m.DB.QueryRowContext(ctx, query, source, value).Scan(&movieID)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+
+		return 0, err
+	}
+
+	return movieID, nil
+}
+
+// Set maps an external id to a movie, replacing the movie's existing id from the
+// same source. ErrRecordNotFound is returned if the movie doesn't exist, and
+// ErrDuplicateExternalID if the id is already mapped to another movie.
+func (m ExternalIDModel) Set(ctx context.Context, movieID int64, source string, value string) error {
+	const query = `
+		INSERT INTO external_ids (
+			movie_id,
+			source,
+			value)
+		VALUES (
+			$1,
+			$2,
+			$3
+		)
+		ON CONFLICT (movie_id, source) DO UPDATE
+		SET
+			value = EXCLUDED.value;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, movieID, source, value)
+
+	return externalIDError(err)
+}
+
+// Delete removes a movie's external id from a source. ErrRecordNotFound is
+// returned if the movie has no id from the source.
+func (m ExternalIDModel) Delete(ctx context.Context, movieID int64, source string) error {
+	const query = `
+		DELETE FROM
+			external_ids
+		WHERE
+			movie_id = $1
+		AND
+			source = $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, source)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// insertExternalIDs stores the external ids of a newly inserted movie inside the
+// insert's transaction.
+func insertExternalIDs(ctx context.Context, tx *sql.Tx, movie *Movie) error {
+	if len(movie.ExternalIDs) == 0 {
+		return nil
+	}
+
+	const query = `
+		INSERT INTO external_ids (
+			movie_id,
+			source,
+			value)
+		SELECT
+			$1,
+			source,
+			value
+		FROM
+			UNNEST($2::text[], $3::text[]) AS ids(source, value);`
+
+	// Sort the sources, so that the rows are always inserted in the same order.
+	sources := slices.Sorted(maps.Keys(movie.ExternalIDs))
+	values := make([]string, len(sources))
+
+	for i, source := range sources {
+		values[i] = movie.ExternalIDs[source]
+	}
+
+	_, err := tx.ExecContext(ctx, query, movie.ID, pq.Array(sources), pq.Array(values))
+
+	return externalIDError(err)
+}
+
+// externalIDError converts the constraint violations of writes to the external_ids
+// table into ErrRecordNotFound and ErrDuplicateExternalID.
+func externalIDError(err error) error {
+	var pqError *pq.Error
+
+	if errors.As(err, &pqError) {
+		switch pqError.Constraint {
+		case "external_ids_movie_id_fkey":
+			return ErrRecordNotFound
+		case "external_ids_pkey":
+			return ErrDuplicateExternalID
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,453 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+var (
+	// Define a custom ErrDuplicateGenre error for when a genre is created or renamed
+	// with a slug or name that is already in use.
+	ErrDuplicateGenre = errors.New("duplicate genre")
+
+	// Define a custom ErrGenreInUse error for when a genre which is still assigned
+	// to movies is deleted.
+	ErrGenreInUse = errors.New("genre in use")
+)
+
+// SlugRX matches a lowercase slug made up of letters and numbers separated by
+// single hyphens, like "science-fiction".
+var SlugRX = regexp.MustCompile("^[a-z0-9]+(?:-[a-z0-9]+)*$")
+
+var slugSeparatorRX = regexp.MustCompile("[^a-z0-9]+")
+
+type Genre struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Version   int32     `json:"version"`
+}
+
+// Slugify converts a genre name like "Sci-Fi" or "sci fi" into its slug "sci-fi".
+// Variations in case and punctuation of a genre name have the same slug, so they
+// find the same genre with GenreSet.Find().
+func Slugify(name string) string {
+	return strings.Trim(slugSeparatorRX.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// A GenreSet is the list of known genres which the genres of a movie are validated
+// against.
+type GenreSet []*Genre
+
+// Find returns the known genre which a genre name given by a client refers to, or
+// nil if there is none. The name finds the genre with the same name ignoring case,
+// or else the genre whose slug is the slug of the name. So "Science Fiction" finds
+// a genre with that name even if it was given the slug "sci-fi", and "sci-fi" or
+// "Sci Fi" find it by its slug. The find_genre() SQL function matches genres in the
+// same way.
+func (s GenreSet) Find(name string) *Genre {
+	for _, genre := range s {
+		if strings.EqualFold(genre.Name, name) {
+			return genre
+		}
+	}
+
+	slug := Slugify(name)
+
+	for _, genre := range s {
+		if genre.Slug == slug {
+			return genre
+		}
+	}
+
+	return nil
+}
+
+// Contains reports whether name finds a known genre.
+func (s GenreSet) Contains(name string) bool {
+	return s.Find(name) != nil
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+	// Slugify() drops anything other than ASCII letters and digits, so a slug must
+	// be given for a name like "日本映画" which has none.
+	v.Check(genre.Slug != "", "slug", "must be provided when the name has no ASCII letters or digits")
+	v.Check(validator.Matches(genre.Slug, SlugRX), "slug", "must only contain lowercase letters, numbers and hyphens")
+}
+
+// Define a GenreModel struct type which wraps a sql.DB connection pool.
+type GenreModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+func (m GenreModel) Insert(ctx context.Context, genre *Genre) error {
+	const query = `
+		INSERT INTO genres (
+			slug,
+			name)
+		VALUES (
+			$1,
+			$2
+		)
+		RETURNING
+			id,
+			created_at,
+			version;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, genre.Slug, genre.Name).Scan(&genre.ID, &genre.CreatedAt, &genre.Version)
+
+	if err != nil {
+		return genreError(err)
+	}
+
+	return nil
+}
+
+// GetAll returns every known genre ordered by name. The list of genres is small,
+// so it isn't paginated.
+func (m GenreModel) GetAll(ctx context.Context) (GenreSet, error) {
+	const query = `
+		SELECT
+			id,
+			created_at,
+			slug,
+			name,
+			version
+		FROM
+			genres
+		ORDER BY
+			name ASC;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	genres := GenreSet{}
+
+	for rows.Next() {
+		var genre Genre
+
+		err := rows.Scan(&genre.ID, &genre.CreatedAt, &genre.Slug, &genre.Name, &genre.Version)
+
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+func (m GenreModel) Get(ctx context.Context, id int64) (*Genre, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	const query = `
+		SELECT
+			id,
+			created_at,
+			slug,
+			name,
+			version
+		FROM
+			genres
+		WHERE
+			id = $1;`
+
+	var genre Genre
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&genre.ID, &genre.CreatedAt, &genre.Slug, &genre.Name, &genre.Version)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &genre, nil
+}
+
+// Update renames a genre using the same optimistic locking as movies. Since movies
+// reference genres by id, the new name is shown on every movie with the genre.
+func (m GenreModel) Update(ctx context.Context, genre *Genre) error {
+	const query = `
+		UPDATE
+			genres
+		SET
+			slug = $1,
+			name = $2,
+			version = version + 1
+		WHERE
+			id = $3
+		AND
+			version = $4
+		RETURNING
+			version;`
+
+	args := []any{genre.Slug, genre.Name, genre.ID, genre.Version}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&genre.Version)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+
+		return genreError(err)
+	}
+
+	return nil
+}
+
+func (m GenreModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	const query = `
+		DELETE FROM
+			genres
+		WHERE
+			id = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+
+	if err != nil {
+		return genreError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// genreError converts the constraint violations which can happen when writing a
+// genre into our custom errors.
+func genreError(err error) error {
+	var pqError *pq.Error
+
+	if errors.As(err, &pqError) {
+		switch pqError.Constraint {
+		case "genres_slug_key", "genres_name_key":
+			return ErrDuplicateGenre
+		case "movies_genres_genre_id_fkey":
+			return ErrGenreInUse
+		}
+	}
+
+	return err
+}
+
+// setMovieGenres replaces the genres of a movie as part of an existing transaction.
+// Genres are matched to known genres with the find_genre() SQL function, and the
+// genres of the movie are set to the display names of the matching genres.
+func setMovieGenres(ctx context.Context, tx *sql.Tx, movie *Movie) error {
+	const deleteQuery = `
+		DELETE FROM
+			movies_genres
+		WHERE
+			movie_id = $1;`
+
+	_, err := tx.ExecContext(ctx, deleteQuery, movie.ID)
+
+	if err != nil {
+		return err
+	}
+
+	const insertQuery = `
+		WITH inserted AS (
+			INSERT INTO movies_genres (
+				movie_id,
+				genre_id,
+				position)
+			SELECT
+				$1,
+				genres.id,
+				input.position
+			FROM
+				UNNEST($2::text[]) WITH ORDINALITY AS input(name, position)
+			INNER JOIN
+				genres ON genres.id = find_genre(input.name)
+			RETURNING
+				genre_id,
+				position
+		)
+		SELECT
+			genres.name
+		FROM
+			inserted
+		INNER JOIN
+			genres ON genres.id = inserted.genre_id
+		ORDER BY
+			inserted.position;`
+
+	rows, err := tx.QueryContext(ctx, insertQuery, movie.ID, pq.Array(movie.Genres))
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	names := []string{}
+
+	for rows.Next() {
+		var name string
+
+		err := rows.Scan(&name)
+
+		if err != nil {
+			return err
+		}
+
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	// A genre can only be missing if it was deleted after the movie was validated.
+	if len(names) != len(movie.Genres) {
+		return ErrEditConflict
+	}
+
+	movie.Genres = names
+
+	return nil
+}
+
+// insertMoviesGenres stores the genres of several newly inserted movies with a
+// single statement, and then sets the genres of each movie to the display names of
+// the matching genres.
+func insertMoviesGenres(ctx context.Context, tx *sql.Tx, movies []*Movie) error {
+	// Flatten the genres into parallel arrays of movie ids, genre names and
+	// positions which can be passed to UNNEST().
+	movieIDs := []int64{}
+	genreNames := []string{}
+	positions := []int64{}
+	movieIndexes := map[int64]*Movie{}
+
+	for _, movie := range movies {
+		movieIndexes[movie.ID] = movie
+
+		for i, name := range movie.Genres {
+			movieIDs = append(movieIDs, movie.ID)
+			genreNames = append(genreNames, name)
+			positions = append(positions, int64(i+1))
+		}
+	}
+
+	const insertQuery = `
+		INSERT INTO movies_genres (
+			movie_id,
+			genre_id,
+			position)
+		SELECT
+			input.movie_id,
+			genres.id,
+			input.position
+		FROM
+			UNNEST($1::bigint[], $2::text[], $3::integer[]) AS input(movie_id, name, position)
+		INNER JOIN
+			genres ON genres.id = find_genre(input.name);`
+
+	result, err := tx.ExecContext(ctx, insertQuery, pq.Array(movieIDs), pq.Array(genreNames), pq.Array(positions))
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// A genre can only be missing if it was deleted after the movies were validated.
+	if rowsAffected != int64(len(genreNames)) {
+		return ErrEditConflict
+	}
+
+	const selectQuery = `
+		SELECT
+			id,
+			movie_genres(id)
+		FROM
+			UNNEST($1::bigint[]) AS id;`
+
+	ids := make([]int64, 0, len(movies))
+
+	for id := range movieIndexes {
+		ids = append(ids, id)
+	}
+
+	rows, err := tx.QueryContext(ctx, selectQuery, pq.Array(ids))
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var names []string
+
+		err := rows.Scan(&id, pq.Array(&names))
+
+		if err != nil {
+			return err
+		}
+
+		movieIndexes[id].Genres = names
+	}
+
+	return rows.Err()
+}
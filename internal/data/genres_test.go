@@ -0,0 +1,40 @@
+package data
+
+import "testing"
+
+func TestGenreSetFind(t *testing.T) {
+	genres := GenreSet{
+		{ID: 1, Slug: "sci-fi", Name: "Science Fiction"},
+		{ID: 2, Slug: "drama", Name: "Drama"},
+		// The slug of this name is "sci-fi", which is the slug of another genre.
+		{ID: 3, Slug: "sci-fi-shorts", Name: "Sci Fi"},
+	}
+
+	tests := []struct {
+		name   string
+		wantID int64
+	}{
+		{"Science Fiction", 1},
+		{"science fiction", 1},
+		{"sci-fi", 1},
+		{"SCI_FI", 1},
+		{"Drama", 2},
+		{"sci fi", 3},
+		{"science-fiction", 0},
+		{"western", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var id int64
+
+			if genre := genres.Find(tt.name); genre != nil {
+				id = genre.ID
+			}
+
+			if id != tt.wantID {
+				t.Errorf("got genre %d; want %d", id, tt.wantID)
+			}
+		})
+	}
+}
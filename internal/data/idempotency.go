@@ -0,0 +1,201 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// An IdempotencyRecord holds the response to a request made with an Idempotency-Key
+// header. Keys are scoped to the user who sent them, with anonymous requests
+// sharing user ID 0. A nil Status means the original request is still in progress.
+type IdempotencyRecord struct {
+	Key         string
+	UserID      int64
+	Fingerprint []byte
+	Status      *int
+	ContentType string
+	Location    string
+	Body        []byte
+	Expiry      time.Time
+}
+
+// Define a IdempotencyModel struct type which wraps a sql.DB connection pool.
+type IdempotencyModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Reserve claims a key for a new request. It returns true if the key was free, or
+// had expired, in which case the caller should process the request and Complete()
+// the record. Otherwise the existing record for the key is returned.
+func (m IdempotencyModel) Reserve(ctx context.Context, key string, userID int64, fingerprint []byte, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	// An expired record is overwritten in place, as if the key had never been used.
+	const query = `
+		INSERT INTO idempotency_keys (
+			key,
+			user_id,
+			fingerprint,
+			expiry)
+		VALUES (
+			$1,
+			$2,
+			$3,
+			$4
+		)
+		ON CONFLICT (key, user_id) DO UPDATE
+		SET
+			created_at = NOW(),
+			fingerprint = EXCLUDED.fingerprint,
+			status = NULL,
+			content_type = '',
+			location = '',
+			body = NULL,
+			expiry = EXCLUDED.expiry
+		WHERE
+			idempotency_keys.expiry <= NOW()
+		RETURNING
+			key;`
+
+	args := []any{key, userID, fingerprint, time.Now().Add(ttl)}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var reserved string
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&reserved)
+
+	if err == nil {
+		return nil, true, nil
+	}
+
+	// No rows are returned when the key is already held by a record which hasn't
+	// expired, so we return that record instead.
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	record, err := m.get(ctx, key, userID)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return record, false, nil
+}
+
+func (m IdempotencyModel) get(ctx context.Context, key string, userID int64) (*IdempotencyRecord, error) {
+	const query = `
+		SELECT
+			key,
+			user_id,
+			fingerprint,
+			status,
+			content_type,
+			location,
+			body,
+			expiry
+		FROM
+			idempotency_keys
+		WHERE
+			key = $1
+		AND
+			user_id = $2;`
+
+	var record IdempotencyRecord
+
+	err := m.DB.QueryRowContext(ctx, query, key, userID).Scan(
+		&record.Key,
+		&record.UserID,
+		&record.Fingerprint,
+		&record.Status,
+		&record.ContentType,
+		&record.Location,
+		&record.Body,
+		&record.Expiry,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// Complete stores the response to a reserved key so that it can be replayed.
+func (m IdempotencyModel) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	const query = `
+		UPDATE
+			idempotency_keys
+		SET
+			status = $1,
+			content_type = $2,
+			location = $3,
+			body = $4
+		WHERE
+			key = $5
+		AND
+			user_id = $6;`
+
+	args := []any{
+		record.Status,
+		record.ContentType,
+		record.Location,
+		record.Body,
+		record.Key,
+		record.UserID,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+
+	return err
+}
+
+// Release deletes a reserved key whose response shouldn't be replayed (like a
+// server error), so that the client can retry with the same key.
+func (m IdempotencyModel) Release(ctx context.Context, key string, userID int64) error {
+	const query = `
+		DELETE FROM
+			idempotency_keys
+		WHERE
+			key = $1
+		AND
+			user_id = $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, key, userID)
+
+	return err
+}
+
+// DeleteExpired deletes every record whose key has expired, using the index on
+// expiry, and returns the number of records deleted.
+func (m IdempotencyModel) DeleteExpired(ctx context.Context) (int64, error) {
+	const query = `
+		DELETE FROM
+			idempotency_keys
+		WHERE
+			expiry <= NOW();`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Define constants for the kinds of image a movie can have.
+const (
+	ImagePoster   = "poster"
+	ImageBackdrop = "backdrop"
+)
+
+// ImageURLs maps each size of an image, like "original" or "small", to the URL it
+// can be fetched from. It is stored as JSONB.
+type ImageURLs map[string]string
+
+// Scan implements the sql.Scanner interface, so that a NULL column scans into a nil
+// map.
+func (u *ImageURLs) Scan(src any) error {
+	if src == nil {
+		*u = nil
+		return nil
+	}
+
+	js, ok := src.([]byte)
+
+	if !ok {
+		return fmt.Errorf("cannot scan %T into ImageURLs", src)
+	}
+
+	return json.Unmarshal(js, u)
+}
+
+// Value implements the driver.Valuer interface. The JSON is sent as a string, since
+// pq would send a []byte as bytea rather than jsonb.
+func (u ImageURLs) Value() (driver.Value, error) {
+	if u == nil {
+		return nil, nil
+	}
+
+	js, err := json.Marshal(u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return string(js), nil
+}
+
+// An Image is the set of files stored for one image of a movie. Key is the storage
+// prefix the files are stored under.
+type Image struct {
+	Key  string
+	URLs ImageURLs
+}
+
+// SetImage replaces the poster or backdrop of a movie and returns the image it
+// replaced, so that its files can be removed. The key of the returned image is
+// empty if the movie didn't have one. ErrRecordNotFound is returned if the movie
+// doesn't exist.
+func (m MovieModel) SetImage(ctx context.Context, id int64, kind string, image Image) (Image, error) {
+	if kind != ImagePoster && kind != ImageBackdrop {
+		return Image{}, fmt.Errorf("unknown image kind %q", kind)
+	}
+
+	// The column names can't be passed as placeholders, but kind is always one of
+	// the constants checked above.
+	selectQuery := fmt.Sprintf(`
+		SELECT
+			%[1]v_key,
+			%[1]v_urls
+		FROM
+			movies
+		WHERE
+			id = $1
+		FOR UPDATE;`, kind)
+
+	updateQuery := fmt.Sprintf(`
+		UPDATE
+			movies
+		SET
+			%[1]v_key = $1,
+			%[1]v_urls = $2
+		WHERE
+			id = $3;`, kind)
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return Image{}, err
+	}
+
+	defer tx.Rollback()
+
+	var old Image
+
+	err = tx.QueryRowContext(ctx, selectQuery, id).Scan(&old.Key, &old.URLs)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Image{}, ErrRecordNotFound
+		}
+
+		return Image{}, err
+	}
+
+	_, err = tx.ExecContext(ctx, updateQuery, image.Key, image.URLs, id)
+
+	if err != nil {
+		return Image{}, err
+	}
+
+	return old, tx.Commit()
+}
@@ -0,0 +1,467 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// Define a custom ErrDuplicateListItem error for when a movie is added to a list
+// which already contains it.
+var ErrDuplicateListItem = errors.New("duplicate list item")
+
+// A List is a named, ordered collection of movies belonging to a user, like a
+// watchlist. Private lists can only be seen by their owner.
+type List struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitzero"`
+	Public      bool      `json:"public"`
+	Version     int32     `json:"version"`
+}
+
+// A ListItem is a movie on a list. Positions start at 1.
+type ListItem struct {
+	MovieID  int64     `json:"movie_id"`
+	Title    string    `json:"title"`
+	Year     int32     `json:"year,omitzero"`
+	Position int32     `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(list.Description) <= 2_000, "description", "must not be more than 2000 bytes long")
+}
+
+func ValidateListItem(v *validator.Validator, item *ListItem) {
+	v.Check(item.MovieID > 0, "movie_id", "must be provided")
+	v.Check(item.Position >= 0, "position", "must not be negative")
+}
+
+// Define a ListModel struct type which wraps a sql.DB connection pool. It manages
+// both lists and their items.
+type ListModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+func (m ListModel) Insert(ctx context.Context, list *List) error {
+	const query = `
+		INSERT INTO lists (
+			user_id,
+			name,
+			description,
+			public)
+		VALUES (
+			$1,
+			$2,
+			$3,
+			$4
+		)
+		RETURNING
+			id,
+			created_at,
+			updated_at,
+			version;`
+
+	args := []any{list.UserID, list.Name, list.Description, list.Public}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.UpdatedAt, &list.Version)
+}
+
+func (m ListModel) Get(ctx context.Context, id int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	const query = `
+		SELECT
+			id,
+			created_at,
+			updated_at,
+			user_id,
+			name,
+			description,
+			public,
+			version
+		FROM
+			lists
+		WHERE
+			id = $1;`
+
+	var list List
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&list.ID,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+		&list.UserID,
+		&list.Name,
+		&list.Description,
+		&list.Public,
+		&list.Version,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// GetAllForUser returns a page of the lists belonging to a user, both public and
+// private.
+func (m ListModel) GetAllForUser(ctx context.Context, userID int64, filters Filters) ([]*List, *Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*) OVER(),
+			id,
+			created_at,
+			updated_at,
+			user_id,
+			name,
+			description,
+			public,
+			version
+		FROM
+			lists
+		WHERE
+			user_id = $1
+		ORDER BY %v %v, id ASC
+		LIMIT $2
+		OFFSET $3;`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+
+	if err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	lists := []*List{}
+
+	totalRecords := 0
+
+	for rows.Next() {
+		var list List
+
+		err := rows.Scan(
+			&totalRecords,
+			&list.ID,
+			&list.CreatedAt,
+			&list.UpdatedAt,
+			&list.UserID,
+			&list.Name,
+			&list.Description,
+			&list.Public,
+			&list.Version,
+		)
+
+		if err != nil {
+			return nil, &Metadata{}, err
+		}
+
+		lists = append(lists, &list)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return lists, &metadata, nil
+}
+
+// Update saves the name, description and visibility of a list using the same
+// optimistic locking as movies.
+func (m ListModel) Update(ctx context.Context, list *List) error {
+	const query = `
+		UPDATE
+			lists
+		SET
+			name = $1,
+			description = $2,
+			public = $3,
+			updated_at = NOW(),
+			version = version + 1
+		WHERE
+			id = $4
+		AND
+			version = $5
+		RETURNING
+			updated_at,
+			version;`
+
+	args := []any{list.Name, list.Description, list.Public, list.ID, list.Version}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.UpdatedAt, &list.Version)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes a list along with its items.
+func (m ListModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	const query = `
+		DELETE FROM
+			lists
+		WHERE
+			id = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetItems returns a page of the movies on a list.
+func (m ListModel) GetItems(ctx context.Context, listID int64, filters Filters) ([]*ListItem, *Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*) OVER(),
+			list_items.movie_id,
+			movies.title,
+			movies.year,
+			list_items.position,
+			list_items.added_at
+		FROM
+			list_items
+		INNER JOIN
+			movies ON movies.id = list_items.movie_id
+		WHERE
+			list_items.list_id = $1
+		ORDER BY %v %v, list_items.position ASC
+		LIMIT $2
+		OFFSET $3;`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID, filters.limit(), filters.offset())
+
+	if err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	items := []*ListItem{}
+
+	totalRecords := 0
+
+	for rows.Next() {
+		var item ListItem
+
+		err := rows.Scan(
+			&totalRecords,
+			&item.MovieID,
+			&item.Title,
+			&item.Year,
+			&item.Position,
+			&item.AddedAt,
+		)
+
+		if err != nil {
+			return nil, &Metadata{}, err
+		}
+
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return items, &metadata, nil
+}
+
+// The items of each list are ordered by their position.
+var listItems = orderedMovies{parentTable: "lists", table: "list_items", parentColumn: "list_id"}
+
+// AddItem adds a movie to a list at the given position, moving the items from that
+// position onwards down by one. A position of 0, or one past the end of the list,
+// appends the movie. ErrRecordNotFound is returned if the movie doesn't exist, and
+// ErrDuplicateListItem if the list already contains it.
+func (m ListModel) AddItem(ctx context.Context, listID int64, item *ListItem) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	item.Position, err = listItems.insert(ctx, tx, listID, item.MovieID, item.Position, ErrDuplicateListItem)
+
+	if err != nil {
+		return err
+	}
+
+	err = finishListItemChange(ctx, tx, listID, item)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MoveItem moves a movie to a new position on a list, shifting the items in
+// between by one. A position past the end of the list moves the movie to the end.
+// ErrRecordNotFound is returned if the list doesn't contain the movie.
+func (m ListModel) MoveItem(ctx context.Context, listID int64, item *ListItem) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	item.Position, err = listItems.move(ctx, tx, listID, item.MovieID, item.Position)
+
+	if err != nil {
+		return err
+	}
+
+	err = finishListItemChange(ctx, tx, listID, item)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveItem removes a movie from a list and closes the gap it leaves behind.
+// ErrRecordNotFound is returned if the list doesn't contain the movie.
+func (m ListModel) RemoveItem(ctx context.Context, listID int64, movieID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = listItems.remove(ctx, tx, listID, movieID)
+
+	if err != nil {
+		return err
+	}
+
+	err = touchList(ctx, tx, listID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// finishListItemChange reads the title, year and added_at time of an item which
+// has just been added or moved, and updates the list's updated_at time.
+func finishListItemChange(ctx context.Context, tx *sql.Tx, listID int64, item *ListItem) error {
+	const query = `
+		SELECT
+			movies.title,
+			movies.year,
+			list_items.added_at
+		FROM
+			list_items
+		INNER JOIN
+			movies ON movies.id = list_items.movie_id
+		WHERE
+			list_items.list_id = $1
+		AND
+			list_items.movie_id = $2;`
+
+	err := tx.QueryRowContext(ctx, query, listID, item.MovieID).Scan(&item.Title, &item.Year, &item.AddedAt)
+
+	if err != nil {
+		return err
+	}
+
+	return touchList(ctx, tx, listID)
+}
+
+// touchList updates the updated_at time of a list when its items change. The
+// version isn't changed, since the items aren't edited through the list itself.
+func touchList(ctx context.Context, tx *sql.Tx, listID int64) error {
+	const query = `
+		UPDATE
+			lists
+		SET
+			updated_at = NOW()
+		WHERE
+			id = $1;`
+
+	_, err := tx.ExecContext(ctx, query, listID)
+
+	return err
+}
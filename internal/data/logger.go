@@ -0,0 +1,27 @@
+package data
+
+import (
+	"context"
+	"log/slog"
+)
+
+const loggerContextKey = contextKey("logger")
+
+// ContextWithLogger returns a copy of ctx carrying a request-scoped logger, so that
+// errors logged while handling the request carry the same attributes as the
+// request log, like the request ID.
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// LoggerFromContext returns the logger carried by ctx, or slog.Default() if there
+// isn't one.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(loggerContextKey).(*slog.Logger)
+
+	if !ok {
+		return slog.Default()
+	}
+
+	return logger
+}
@@ -0,0 +1,139 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryGenres is a GenreRepository which keeps genres in memory. It is safe for
+// concurrent use and follows the same rules as GenreModel for ids, versions and
+// duplicate slugs and names, but it doesn't know which genres movies use, so it
+// never returns ErrGenreInUse. The zero value is an empty repository.
+type MemoryGenres struct {
+	mu     sync.RWMutex
+	genres map[int64]*Genre
+	lastID int64
+}
+
+// NewMemoryGenres returns a repository holding the genres with the given names,
+// which are slugified, with ids in the same order starting from 1.
+func NewMemoryGenres(names ...string) *MemoryGenres {
+	m := &MemoryGenres{}
+
+	for _, name := range names {
+		m.Insert(context.Background(), &Genre{Slug: Slugify(name), Name: name})
+	}
+
+	return m
+}
+
+func (m *MemoryGenres) Insert(ctx context.Context, genre *Genre) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.duplicate(genre) {
+		return ErrDuplicateGenre
+	}
+
+	if m.genres == nil {
+		m.genres = map[int64]*Genre{}
+	}
+
+	m.lastID++
+
+	genre.ID = m.lastID
+	genre.CreatedAt = time.Now()
+	genre.Version = 1
+
+	stored := *genre
+	m.genres[genre.ID] = &stored
+
+	return nil
+}
+
+// GetAll returns every genre ordered by name, like GenreModel.
+func (m *MemoryGenres) GetAll(ctx context.Context) (GenreSet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	genres := GenreSet{}
+
+	for _, genre := range m.genres {
+		g := *genre
+		genres = append(genres, &g)
+	}
+
+	slices.SortFunc(genres, func(a, b *Genre) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+
+	return genres, nil
+}
+
+func (m *MemoryGenres) Get(ctx context.Context, id int64) (*Genre, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	genre, ok := m.genres[id]
+
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	g := *genre
+
+	return &g, nil
+}
+
+// Update renames a genre if its version still matches, and returns ErrEditConflict
+// otherwise.
+func (m *MemoryGenres) Update(ctx context.Context, genre *Genre) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.genres[genre.ID]
+
+	if !ok || stored.Version != genre.Version {
+		return ErrEditConflict
+	}
+
+	if m.duplicate(genre) {
+		return ErrDuplicateGenre
+	}
+
+	stored.Slug = genre.Slug
+	stored.Name = genre.Name
+	stored.Version++
+
+	genre.Version = stored.Version
+
+	return nil
+}
+
+func (m *MemoryGenres) Delete(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.genres[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.genres, id)
+
+	return nil
+}
+
+// duplicate reports whether another genre already has the slug or name of genre,
+// which the unique constraints of the genres table would reject.
+func (m *MemoryGenres) duplicate(genre *Genre) bool {
+	for _, other := range m.genres {
+		if other.ID != genre.ID && (other.Slug == genre.Slug || other.Name == genre.Name) {
+			return true
+		}
+	}
+
+	return false
+}
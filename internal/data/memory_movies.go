@@ -0,0 +1,782 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryMovies is a MovieRepository which keeps movies in memory, so that handlers
+// can be tested without a database. It is safe for concurrent use, and follows the
+// same rules as MovieModel for versions, filters, sorting and pagination. The data
+// which lives in other tables is simplified:
+//
+//   - there are no translations or release dates, so locales are ignored and
+//     filtering by country matches no movies,
+//   - no revisions are recorded, and the editor is ignored,
+//   - titles are sorted by byte value rather than by the database collation.
+//
+// If Genres isn't nil the genres of a movie are matched to it with GenreSet.Find()
+// and replaced with the genre names, and ErrEditConflict is returned for unknown
+// genres, like MovieModel does. Otherwise the genres are stored as they are given.
+type MemoryMovies struct {
+	Genres *MemoryGenres
+
+	mu        sync.RWMutex
+	movies    map[int64]*Movie
+	images    map[int64]map[string]Image
+	redirects map[int64]int64
+	lastID    int64
+}
+
+// NewMemoryMovies returns an empty repository which matches genres against genres,
+// which may be nil.
+func NewMemoryMovies(genres *MemoryGenres) *MemoryMovies {
+	return &MemoryMovies{
+		Genres:    genres,
+		movies:    map[int64]*Movie{},
+		images:    map[int64]map[string]Image{},
+		redirects: map[int64]int64{},
+	}
+}
+
+// cloneMovie returns a deep copy of a movie, so that callers can't change the
+// stored movies and the stored movies can't change under them.
+func cloneMovie(movie *Movie) *Movie {
+	c := *movie
+	c.Genres = slices.Clone(movie.Genres)
+	c.Poster = maps.Clone(movie.Poster)
+	c.Backdrop = maps.Clone(movie.Backdrop)
+	c.ExternalIDs = maps.Clone(movie.ExternalIDs)
+	c.Credits = nil
+
+	return &c
+}
+
+// knownGenres returns the genres of the Genres repository, or nil if there isn't
+// one. MemoryGenres.GetAll() never fails.
+func (m *MemoryMovies) knownGenres(ctx context.Context) GenreSet {
+	if m.Genres == nil {
+		return nil
+	}
+
+	known, _ := m.Genres.GetAll(ctx)
+
+	return known
+}
+
+// genreNames returns the names of the known genres matching the given genres, in
+// the same order. ErrEditConflict is returned if one of them isn't known.
+func (m *MemoryMovies) genreNames(ctx context.Context, genres []string) ([]string, error) {
+	if m.Genres == nil {
+		return slices.Clone(genres), nil
+	}
+
+	known := m.knownGenres(ctx)
+
+	names := make([]string, 0, len(genres))
+
+	for _, name := range genres {
+		genre := known.Find(name)
+
+		if genre == nil {
+			return nil, ErrEditConflict
+		}
+
+		names = append(names, genre.Name)
+	}
+
+	return names, nil
+}
+
+// sameGenre reports whether the genre names a and b find the same known genre. If
+// there are no known genres, they are compared by slug.
+func sameGenre(known GenreSet, a string, b string) bool {
+	if known == nil {
+		return Slugify(a) == Slugify(b)
+	}
+
+	genre := known.Find(a)
+
+	return genre != nil && genre == known.Find(b)
+}
+
+// externalIDTaken reports whether a movie other than id is mapped to the value of
+// the source.
+func (m *MemoryMovies) externalIDTaken(id int64, source string, value string) bool {
+	for _, movie := range m.movies {
+		if movie.ID != id && movie.ExternalIDs[source] == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// store adds a new movie with the next id. The caller must hold the lock.
+func (m *MemoryMovies) store(movie *Movie, genres []string, externalIDs ExternalIDs) {
+	m.lastID++
+
+	movie.ID = m.lastID
+	movie.CreatedAt = time.Now().Truncate(time.Second)
+	movie.Version = 1
+	movie.Genres = genres
+	movie.ExternalIDs = externalIDs
+	movie.Rating = 0
+	movie.RatingCount = 0
+	movie.Poster = nil
+	movie.Backdrop = nil
+	movie.Locale = ""
+	movie.Overview = ""
+
+	m.movies[movie.ID] = cloneMovie(movie)
+}
+
+func (m *MemoryMovies) Insert(ctx context.Context, movie *Movie, editor Editor) error {
+	genres, err := m.genreNames(ctx, movie.Genres)
+
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for source, value := range movie.ExternalIDs {
+		if m.externalIDTaken(0, source, value) {
+			return ErrDuplicateExternalID
+		}
+	}
+
+	m.store(movie, genres, maps.Clone(movie.ExternalIDs))
+
+	return nil
+}
+
+// InsertBatch inserts all of the movies or none of them. Like MovieModel, it
+// doesn't store external ids.
+func (m *MemoryMovies) InsertBatch(ctx context.Context, movies []*Movie, editor Editor) error {
+	genres := make([][]string, len(movies))
+
+	for i, movie := range movies {
+		names, err := m.genreNames(ctx, movie.Genres)
+
+		if err != nil {
+			return err
+		}
+
+		genres[i] = names
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, movie := range movies {
+		m.store(movie, genres[i], nil)
+	}
+
+	return nil
+}
+
+// Import inserts the movies with InsertBatch(), so that either all of them are
+// imported or none are.
+func (m *MemoryMovies) Import(ctx context.Context, movies []*Movie, editor Editor) error {
+	return m.InsertBatch(ctx, movies, editor)
+}
+
+func (m *MemoryMovies) Get(ctx context.Context, id int64) (*Movie, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	movie, ok := m.movies[id]
+
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return cloneMovie(movie), nil
+}
+
+func (m *MemoryMovies) Exists(ctx context.Context, id int64) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.movies[id]
+
+	return ok, nil
+}
+
+// GetLocalized is the same as Get(), since there are no translations.
+func (m *MemoryMovies) GetLocalized(ctx context.Context, id int64, locales []string) (*Movie, error) {
+	return m.Get(ctx, id)
+}
+
+// Update saves the title, year, runtime and genres of a movie if its version still
+// matches, and returns ErrEditConflict otherwise.
+func (m *MemoryMovies) Update(ctx context.Context, movie *Movie, editor Editor) error {
+	genres, err := m.genreNames(ctx, movie.Genres)
+
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[movie.ID]
+
+	if !ok || stored.Version != movie.Version {
+		return ErrEditConflict
+	}
+
+	stored.Title = movie.Title
+	stored.Year = movie.Year
+	stored.Runtime = movie.Runtime
+	stored.Genres = slices.Clone(genres)
+	stored.Version++
+
+	movie.Genres = genres
+	movie.Version = stored.Version
+
+	return nil
+}
+
+// Delete removes a movie along with its images and the redirects to it, like the
+// cascading deletes of the database.
+// Delete returns the images of the movie, like MovieModel.
+func (m *MemoryMovies) Delete(ctx context.Context, id int64, editor Editor) ([]Image, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.movies[id]; !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	var images []Image
+
+	for _, kind := range []string{ImagePoster, ImageBackdrop} {
+		if image, ok := m.images[id][kind]; ok {
+			images = append(images, image)
+		}
+	}
+
+	m.remove(id)
+
+	return images, nil
+}
+
+// remove deletes a movie and everything that refers to it. The caller must hold
+// the lock.
+func (m *MemoryMovies) remove(id int64) {
+	delete(m.movies, id)
+	delete(m.images, id)
+
+	maps.DeleteFunc(m.redirects, func(_ int64, movieID int64) bool {
+		return movieID == id
+	})
+}
+
+// filter returns the movies matching the title, genres and country filters of
+// GetAll(), in no particular order. The caller must hold the lock.
+func (m *MemoryMovies) filter(ctx context.Context, title string, genres []string, country string) []*Movie {
+	movies := []*Movie{}
+
+	// There are no release dates, so no movie was released in the country.
+	if country != "" {
+		return movies
+	}
+
+	known := m.knownGenres(ctx)
+
+	for _, movie := range m.movies {
+		if title != "" && !strings.EqualFold(movie.Title, title) {
+			continue
+		}
+
+		// Every genre filtered by must find one of the genres of the movie.
+		missing := slices.ContainsFunc(genres, func(want string) bool {
+			return !slices.ContainsFunc(movie.Genres, func(have string) bool {
+				return sameGenre(known, want, have)
+			})
+		})
+
+		if !missing {
+			movies = append(movies, movie)
+		}
+	}
+
+	return movies
+}
+
+// sortMovies sorts movies by the sort column and direction of the filters, and then
+// by id, like the ORDER BY clause of GetAll().
+func sortMovies(movies []*Movie, filters Filters) {
+	column := filters.sortColumn()
+	desc := filters.sortDirection() == "DESC"
+
+	slices.SortFunc(movies, func(a, b *Movie) int {
+		var c int
+
+		switch column {
+		case "id":
+			c = cmp.Compare(a.ID, b.ID)
+		case "title":
+			c = cmp.Compare(a.Title, b.Title)
+		case "genres":
+			c = slices.Compare(a.Genres, b.Genres)
+		case "year":
+			c = cmp.Compare(a.Year, b.Year)
+		case "runtime":
+			c = cmp.Compare(a.Runtime, b.Runtime)
+		case "rating":
+			c = cmp.Compare(a.Rating, b.Rating)
+		default:
+			panic(fmt.Sprintf("unsupported sort column: %v", column))
+		}
+
+		if desc {
+			c = -c
+		}
+
+		return cmp.Or(c, cmp.Compare(a.ID, b.ID))
+	})
+}
+
+// paginate returns the page of items selected by the filters, along with the
+// metadata for it. Like the COUNT(*) OVER() queries, the metadata is empty when the
+// page is past the last one.
+func paginate[T any](items []T, filters Filters) ([]T, *Metadata) {
+	start := min(filters.offset(), len(items))
+	end := min(start+filters.limit(), len(items))
+
+	page := items[start:end]
+	total := len(items)
+
+	if len(page) == 0 {
+		total = 0
+	}
+
+	metadata := calculateMetadata(total, filters.Page, filters.PageSize)
+
+	return page, &metadata
+}
+
+func (m *MemoryMovies) GetAll(ctx context.Context, title string, genres []string, country string, locales []string, filters Filters) ([]*Movie, *Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	movies := m.filter(ctx, title, genres, country)
+
+	sortMovies(movies, filters)
+
+	page, metadata := paginate(movies, filters)
+
+	result := make([]*Movie, len(page))
+
+	for i, movie := range page {
+		result[i] = cloneMovie(movie)
+	}
+
+	return result, metadata, nil
+}
+
+// Export calls fn for every matching movie. The movies are copied before fn is
+// called, so fn can use the repository without deadlocking.
+func (m *MemoryMovies) Export(ctx context.Context, title string, genres []string, country string, filters Filters, fn func(*Movie) error) error {
+	m.mu.RLock()
+
+	movies := m.filter(ctx, title, genres, country)
+
+	sortMovies(movies, filters)
+
+	for i, movie := range movies {
+		movies[i] = cloneMovie(movie)
+	}
+
+	m.mu.RUnlock()
+
+	for _, movie := range movies {
+		err := fn(movie)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetImage replaces the poster or backdrop of a movie and returns the image it
+// replaced. Like MovieModel, it doesn't change the version of the movie.
+func (m *MemoryMovies) SetImage(ctx context.Context, id int64, kind string, image Image) (Image, error) {
+	if kind != ImagePoster && kind != ImageBackdrop {
+		return Image{}, fmt.Errorf("unknown image kind %q", kind)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	movie, ok := m.movies[id]
+
+	if !ok {
+		return Image{}, ErrRecordNotFound
+	}
+
+	old := m.images[id][kind]
+
+	m.setImage(movie, kind, image)
+
+	if m.images[id] == nil {
+		m.images[id] = map[string]Image{}
+	}
+
+	m.images[id][kind] = image
+
+	return old, nil
+}
+
+// setImage sets the URLs of the poster or backdrop of a stored movie. The caller
+// must hold the lock.
+func (m *MemoryMovies) setImage(movie *Movie, kind string, image Image) {
+	if kind == ImagePoster {
+		movie.Poster = maps.Clone(image.URLs)
+	} else {
+		movie.Backdrop = maps.Clone(image.URLs)
+	}
+}
+
+// GetSimilar scores the movies which share a genre with the movie in the same way
+// as MovieModel.GetSimilar(), with every movie as a candidate.
+func (m *MemoryMovies) GetSimilar(ctx context.Context, movieID int64, weights SimilarityWeights, limit int) ([]*SimilarMovie, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	similar := []*SimilarMovie{}
+
+	target, ok := m.movies[movieID]
+
+	if !ok {
+		return similar, nil
+	}
+
+	// The scorer compares sorted genre ids, so each slug is given a number.
+	ids := map[string]int64{}
+
+	entry := func(movie *Movie) similarityEntry {
+		e := similarityEntry{id: movie.ID, year: movie.Year, runtime: int32(movie.Runtime)}
+
+		for _, name := range movie.Genres {
+			slug := Slugify(name)
+
+			if _, ok := ids[slug]; !ok {
+				ids[slug] = int64(len(ids) + 1)
+			}
+
+			e.genres = append(e.genres, ids[slug])
+		}
+
+		slices.Sort(e.genres)
+		e.genres = slices.Compact(e.genres)
+
+		return e
+	}
+
+	entries := make([]similarityEntry, 0, len(m.movies))
+
+	for _, movie := range m.movies {
+		entries = append(entries, entry(movie))
+	}
+
+	for _, s := range topSimilar(entry(target), entries, weights, limit) {
+		similar = append(similar, &SimilarMovie{Score: s.score, Movie: cloneMovie(m.movies[s.id])})
+	}
+
+	return similar, nil
+}
+
+// GetRandom picks movies in the same way as MovieModel.GetRandom(), so the same
+// seed picks the same movies.
+func (m *MemoryMovies) GetRandom(ctx context.Context, filters RandomFilters, count int, seed uint64) ([]*Movie, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	movies := slices.DeleteFunc(m.filter(ctx, filters.Title, filters.Genres, filters.Country), func(movie *Movie) bool {
+		return (filters.MinYear != 0 && movie.Year < filters.MinYear) ||
+			(filters.MaxYear != 0 && movie.Year > filters.MaxYear) ||
+			(filters.MinRuntime != 0 && int32(movie.Runtime) < filters.MinRuntime) ||
+			(filters.MaxRuntime != 0 && int32(movie.Runtime) > filters.MaxRuntime)
+	})
+
+	slices.SortFunc(movies, func(a, b *Movie) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	rng := rand.New(rand.NewPCG(seed, seed))
+	picked := []*Movie{}
+
+	if len(movies) <= randomScanLimit {
+		for _, position := range samplePositions(rng, len(movies), count) {
+			picked = append(picked, cloneMovie(movies[position]))
+		}
+
+		return picked, nil
+	}
+
+	minID, maxID := int64(math.MaxInt64), int64(0)
+
+	for id := range m.movies {
+		minID, maxID = min(minID, id), max(maxID, id)
+	}
+
+	ids, _ := probeRandom(rng, minID, maxID, count, func(starts []int64) ([]int64, error) {
+		ids := make([]int64, len(starts))
+
+		for i, start := range starts {
+			j, _ := slices.BinarySearchFunc(movies, start, func(movie *Movie, id int64) int {
+				return cmp.Compare(movie.ID, id)
+			})
+
+			ids[i] = movies[j%len(movies)].ID
+		}
+
+		return ids, nil
+	})
+
+	for _, id := range ids {
+		picked = append(picked, cloneMovie(m.movies[id]))
+	}
+
+	return picked, nil
+}
+
+func (m *MemoryMovies) GetStats(ctx context.Context, title string, genres []string, country string) (*MovieStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	movies := m.filter(ctx, title, genres, country)
+
+	stats := &MovieStats{
+		TotalMovies: len(movies),
+		Genres:      []*GenreCount{},
+		Decades:     []*DecadeCount{},
+	}
+
+	if len(movies) == 0 {
+		return stats, nil
+	}
+
+	known := m.knownGenres(ctx)
+
+	runtimes := make([]float64, len(movies))
+	genreCounts := map[string]*GenreCount{}
+	decadeCounts := map[int32]*DecadeCount{}
+	total := 0.0
+
+	stats.OldestYear = movies[0].Year
+	stats.NewestYear = movies[0].Year
+
+	for i, movie := range movies {
+		runtimes[i] = float64(movie.Runtime)
+		total += runtimes[i]
+
+		stats.OldestYear = min(stats.OldestYear, movie.Year)
+		stats.NewestYear = max(stats.NewestYear, movie.Year)
+
+		for _, name := range movie.Genres {
+			slug := Slugify(name)
+
+			if genre := known.Find(name); genre != nil {
+				slug = genre.Slug
+			}
+
+			if genreCounts[slug] == nil {
+				genreCounts[slug] = &GenreCount{Slug: slug, Name: name}
+				stats.Genres = append(stats.Genres, genreCounts[slug])
+			}
+
+			genreCounts[slug].Count++
+		}
+
+		decade := movie.Year / 10 * 10
+
+		if decadeCounts[decade] == nil {
+			decadeCounts[decade] = &DecadeCount{Decade: decade}
+			stats.Decades = append(stats.Decades, decadeCounts[decade])
+		}
+
+		decadeCounts[decade].Count++
+	}
+
+	// PERCENTILE_CONT(0.5) averages the two middle values of an even number of
+	// runtimes.
+	slices.Sort(runtimes)
+
+	median := runtimes[len(runtimes)/2]
+
+	if len(runtimes)%2 == 0 {
+		median = (runtimes[len(runtimes)/2-1] + median) / 2
+	}
+
+	stats.AverageRuntime = Runtime(math.Round(total / float64(len(runtimes))))
+	stats.MedianRuntime = Runtime(math.Round(median))
+
+	slices.SortFunc(stats.Genres, func(a, b *GenreCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+
+	slices.SortFunc(stats.Decades, func(a, b *DecadeCount) int {
+		return cmp.Compare(a.Decade, b.Decade)
+	})
+
+	return stats, nil
+}
+
+var (
+	titleArticleRX   = regexp.MustCompile(`^(the|a|an)\s+|,\s*(the|a|an)$`)
+	titleSeparatorRX = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+)
+
+// normalizeTitle reduces a title in the same way as the normalize_title() SQL
+// function.
+func normalizeTitle(title string) string {
+	title = titleArticleRX.ReplaceAllString(strings.ToLower(title), "")
+	return titleSeparatorRX.ReplaceAllString(title, "")
+}
+
+func (m *MemoryMovies) GetDuplicates(ctx context.Context, runtimeTolerance int32, filters Filters) ([]*DuplicateCandidate, *Metadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	candidates := []*DuplicateCandidate{}
+
+	for _, movie := range m.movies {
+		for _, duplicate := range m.movies {
+			if duplicate.ID <= movie.ID || duplicate.Year != movie.Year || normalizeTitle(duplicate.Title) != normalizeTitle(movie.Title) {
+				continue
+			}
+
+			if math.Abs(float64(duplicate.Runtime-movie.Runtime)) > float64(runtimeTolerance) {
+				continue
+			}
+
+			candidates = append(candidates, &DuplicateCandidate{Movie: movie, Duplicate: duplicate})
+		}
+	}
+
+	desc := filters.sortDirection() == "DESC"
+
+	slices.SortFunc(candidates, func(a, b *DuplicateCandidate) int {
+		c := cmp.Compare(a.Movie.ID, b.Movie.ID)
+
+		if desc {
+			c = -c
+		}
+
+		return cmp.Or(c, cmp.Compare(a.Duplicate.ID, b.Duplicate.ID))
+	})
+
+	page, metadata := paginate(candidates, filters)
+
+	result := make([]*DuplicateCandidate, len(page))
+
+	for i, candidate := range page {
+		result[i] = &DuplicateCandidate{Movie: cloneMovie(candidate.Movie), Duplicate: cloneMovie(candidate.Duplicate)}
+	}
+
+	return result, metadata, nil
+}
+
+// Merge folds the source movie into the target. The target takes the images and
+// external ids of the source which it doesn't have itself, the redirects to the
+// source are moved to the target, and the source is deleted.
+func (m *MemoryMovies) Merge(ctx context.Context, sourceID int64, targetID int64, editor Editor) ([]Image, error) {
+	if sourceID == targetID {
+		return nil, errors.New("cannot merge a movie into itself")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	source, ok := m.movies[sourceID]
+
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	target, ok := m.movies[targetID]
+
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	var discarded []Image
+
+	for _, kind := range []string{ImagePoster, ImageBackdrop} {
+		image, ok := m.images[sourceID][kind]
+
+		if !ok || image.Key == "" {
+			continue
+		}
+
+		if m.images[targetID][kind].Key != "" {
+			discarded = append(discarded, image)
+			continue
+		}
+
+		if m.images[targetID] == nil {
+			m.images[targetID] = map[string]Image{}
+		}
+
+		m.images[targetID][kind] = image
+		m.setImage(target, kind, image)
+	}
+
+	for name, value := range source.ExternalIDs {
+		if _, ok := target.ExternalIDs[name]; !ok {
+			if target.ExternalIDs == nil {
+				target.ExternalIDs = ExternalIDs{}
+			}
+
+			target.ExternalIDs[name] = value
+		}
+	}
+
+	target.Version++
+
+	for id, movieID := range m.redirects {
+		if movieID == sourceID {
+			m.redirects[id] = targetID
+		}
+	}
+
+	// The source is deleted without remove(), which would delete the redirects to
+	// it which were just moved to the target.
+	delete(m.movies, sourceID)
+	delete(m.images, sourceID)
+
+	m.redirects[sourceID] = targetID
+
+	return discarded, nil
+}
+
+func (m *MemoryMovies) GetRedirect(ctx context.Context, id int64) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	movieID, ok := m.redirects[id]
+
+	if !ok {
+		return 0, ErrRecordNotFound
+	}
+
+	return movieID, nil
+}
@@ -0,0 +1,193 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"The Matrix", "matrix"},
+		{"Matrix, The", "matrix"},
+		{"A Quiet Place", "quietplace"},
+		{"An American Werewolf in London", "americanwerewolfinlondon"},
+		{"Theory of Everything", "theoryofeverything"},
+		{"Spider-Man: No Way Home", "spidermannowayhome"},
+		{"Amélie", "amélie"},
+		{"2001: A Space Odyssey", "2001aspaceodyssey"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := normalizeTitle(tt.title); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestMemoryMovies(t *testing.T) *MemoryMovies {
+	t.Helper()
+
+	genres := NewMemoryGenres("Action", "Comedy", "Drama", "Sci-Fi")
+	movies := NewMemoryMovies(genres)
+
+	for _, movie := range []*Movie{
+		{Title: "Moon", Year: 2009, Runtime: 97, Genres: []string{"drama", "sci-fi"}},
+		{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"sci-fi"}},
+		{Title: "Airplane!", Year: 1980, Runtime: 88, Genres: []string{"comedy"}},
+		{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"action", "drama"}},
+		{Title: "Arrival", Year: 2016, Runtime: 116, Genres: []string{"drama", "sci-fi"}},
+	} {
+		err := movies.Insert(context.Background(), movie, Editor{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return movies
+}
+
+func TestMemoryMoviesGetAll(t *testing.T) {
+	movies := newTestMemoryMovies(t)
+
+	sortSafeList := []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+
+	tests := []struct {
+		name         string
+		title        string
+		genres       []string
+		country      string
+		page         int
+		sort         string
+		wantIDs      []int64
+		wantMetadata Metadata
+	}{
+		{
+			name:         "all by id",
+			page:         1,
+			sort:         "id",
+			wantIDs:      []int64{1, 2, 3},
+			wantMetadata: Metadata{CurrentPage: 1, PageSize: 3, FirstPage: 1, LastPage: 2, TotalRecords: 5},
+		},
+		{
+			name:         "second page",
+			page:         2,
+			sort:         "id",
+			wantIDs:      []int64{4, 5},
+			wantMetadata: Metadata{CurrentPage: 2, PageSize: 3, FirstPage: 1, LastPage: 2, TotalRecords: 5},
+		},
+		{
+			name:    "past the last page",
+			page:    3,
+			sort:    "id",
+			wantIDs: []int64{},
+		},
+		{
+			name:         "newest first",
+			page:         1,
+			sort:         "-year",
+			wantIDs:      []int64{5, 1, 4},
+			wantMetadata: Metadata{CurrentPage: 1, PageSize: 3, FirstPage: 1, LastPage: 2, TotalRecords: 5},
+		},
+		{
+			name:         "title ignores case",
+			title:        "MOON",
+			page:         1,
+			sort:         "id",
+			wantIDs:      []int64{1},
+			wantMetadata: Metadata{CurrentPage: 1, PageSize: 3, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+		},
+		{
+			name:         "every genre must match",
+			genres:       []string{"Sci-Fi", "drama"},
+			page:         1,
+			sort:         "title",
+			wantIDs:      []int64{5, 1},
+			wantMetadata: Metadata{CurrentPage: 1, PageSize: 3, FirstPage: 1, LastPage: 1, TotalRecords: 2},
+		},
+		{
+			name:    "no releases in a country",
+			country: "GB",
+			page:    1,
+			sort:    "id",
+			wantIDs: []int64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := Filters{Page: tt.page, PageSize: 3, Sort: tt.sort, SortSafeList: sortSafeList}
+
+			got, metadata, err := movies.GetAll(context.Background(), tt.title, tt.genres, tt.country, nil, filters)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []int64{}
+
+			for _, movie := range got {
+				ids = append(ids, movie.ID)
+			}
+
+			if len(ids) != len(tt.wantIDs) {
+				t.Fatalf("got ids %v; want %v", ids, tt.wantIDs)
+			}
+
+			for i := range ids {
+				if ids[i] != tt.wantIDs[i] {
+					t.Fatalf("got ids %v; want %v", ids, tt.wantIDs)
+				}
+			}
+
+			if *metadata != tt.wantMetadata {
+				t.Errorf("got metadata %+v; want %+v", *metadata, tt.wantMetadata)
+			}
+		})
+	}
+}
+
+func TestMemoryMoviesGetAllReturnsCopies(t *testing.T) {
+	movies := newTestMemoryMovies(t)
+
+	filters := Filters{Page: 1, PageSize: 1, Sort: "id", SortSafeList: []string{"id"}}
+
+	got, _, _ := movies.GetAll(context.Background(), "", nil, "", nil, filters)
+	got[0].Title = "Changed"
+
+	movie, _ := movies.Get(context.Background(), 1)
+
+	if movie.Title != "Moon" {
+		t.Errorf("got title %q; want the stored movie unchanged", movie.Title)
+	}
+}
+
+func TestMemoryMoviesImportIsAtomic(t *testing.T) {
+	movies := newTestMemoryMovies(t)
+
+	rows := []*Movie{
+		{Title: "Up", Year: 2009, Runtime: 96, Genres: []string{"comedy"}},
+		{Title: "Unknown", Year: 2009, Runtime: 96, Genres: []string{"western"}},
+	}
+
+	err := movies.Import(context.Background(), rows, Editor{})
+
+	if !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("got %v; want %v", err, ErrEditConflict)
+	}
+
+	filters := Filters{Page: 1, PageSize: 10, Sort: "id", SortSafeList: []string{"id"}}
+
+	_, metadata, _ := movies.GetAll(context.Background(), "", nil, "", nil, filters)
+
+	if metadata.TotalRecords != 5 {
+		t.Errorf("got %d movies; want the 5 from before the import", metadata.TotalRecords)
+	}
+}
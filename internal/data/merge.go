@@ -0,0 +1,455 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A DuplicateCandidate is a pair of movies which look like the same film: their
+// titles are the same once normalized, they were released in the same year and
+// their runtimes are close. The duplicate is always the newer of the two.
+type DuplicateCandidate struct {
+	Movie     *Movie `json:"movie"`
+	Duplicate *Movie `json:"duplicate"`
+}
+
+// GetDuplicates returns a page of duplicate candidates whose runtimes differ by no
+// more than the tolerance, ordered by the id of the older movie. Only the page and
+// page size of the filters are used.
+func (m MovieModel) GetDuplicates(ctx context.Context, runtimeTolerance int32, filters Filters) ([]*DuplicateCandidate, *Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*) OVER(),
+			movie.id,
+			movie.created_at,
+			movie.title,
+			movie.year,
+			movie.runtime,
+			movie_genres(movie.id),
+			movie.version,
+			duplicate.id,
+			duplicate.created_at,
+			duplicate.title,
+			duplicate.year,
+			duplicate.runtime,
+			movie_genres(duplicate.id),
+			duplicate.version
+		FROM
+			movies AS movie
+		INNER JOIN
+			movies AS duplicate ON normalize_title(duplicate.title) = normalize_title(movie.title)
+			AND duplicate.year = movie.year
+			AND duplicate.id > movie.id
+		WHERE
+			ABS(duplicate.runtime - movie.runtime) <= $1
+		ORDER BY movie.id %v, duplicate.id ASC
+		LIMIT $2
+		OFFSET $3;`, filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, runtimeTolerance, filters.limit(), filters.offset())
+
+	if err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	candidates := []*DuplicateCandidate{}
+
+	totalRecords := 0
+
+	for rows.Next() {
+		var movie, duplicate Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&duplicate.ID,
+			&duplicate.CreatedAt,
+			&duplicate.Title,
+			&duplicate.Year,
+			&duplicate.Runtime,
+			pq.Array(&duplicate.Genres),
+			&duplicate.Version,
+		)
+
+		if err != nil {
+			return nil, &Metadata{}, err
+		}
+
+		candidates = append(candidates, &DuplicateCandidate{Movie: &movie, Duplicate: &duplicate})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return candidates, &metadata, nil
+}
+
+// The tables whose rows belong to a single movie, along with the columns which
+// must be unique for each movie. When a movie is merged its rows are moved to the
+// other movie, unless the other movie already has a row with the same values in
+// those columns.
+var mergedTables = []struct {
+	table   string
+	columns []string
+}{
+	{table: "ratings", columns: []string{"user_id"}},
+	{table: "reviews", columns: []string{"user_id"}},
+	{table: "watch_history"},
+	{table: "movie_credits", columns: []string{"person_id", "role", "character"}},
+	{table: "external_ids", columns: []string{"source"}},
+	{table: "movie_translations", columns: []string{"locale"}},
+	{table: "movie_releases", columns: []string{"country"}},
+}
+
+// Merge folds the source movie into the target movie and deletes the source. The
+// ratings, reviews, watch history, credits, external ids, translations, releases,
+// list items, collection movies and relations of the source are moved to the
+// target, except where the target already has its own, in which case the target's
+// are kept. The target keeps its own title, year, runtime and genres, and takes
+// the poster and backdrop of the source only if it doesn't have one.
+//
+// The version of the target is bumped and the change to it is recorded as an
+// update revision. The id of the source is recorded as a redirect to the target,
+// and the deletion of the source is recorded as a revision. The images of the source which weren't
+// taken by the target are returned so that their files can be removed.
+// ErrRecordNotFound is returned if either movie doesn't exist.
+func (m MovieModel) Merge(ctx context.Context, sourceID int64, targetID int64, editor Editor) ([]Image, error) {
+	if sourceID < 1 || targetID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	if sourceID == targetID {
+		return nil, errors.New("cannot merge a movie into itself")
+	}
+
+	// A merge touches many tables, so it is allowed longer than a single query.
+	ctx, cancel := context.WithTimeout(ctx, max(m.Timeout, 10*time.Second))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	// Lock both movies in id order, so that two merges of the same pair of movies
+	// can't deadlock.
+	locked := map[int64]*Movie{}
+
+	for _, id := range []int64{min(sourceID, targetID), max(sourceID, targetID)} {
+		locked[id], err = getMovieForUpdate(ctx, tx, id, 0)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	discarded, err := mergeMovieImages(ctx, tx, sourceID, targetID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, merged := range mergedTables {
+		err = moveMovieRows(ctx, tx, merged.table, merged.columns, sourceID, targetID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ordered := range []orderedMovies{listItems, collectionMovies} {
+		err = ordered.replace(ctx, tx, sourceID, targetID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = moveMovieRelations(ctx, tx, sourceID, targetID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The target may have gained the images and external ids of the source, so its
+	// version is bumped, which makes clients holding the old version get an edit
+	// conflict, and the change is recorded as a revision of the target.
+	const versionQuery = `
+		UPDATE
+			movies
+		SET
+			version = version + 1
+		WHERE
+			id = $1;`
+
+	_, err = tx.ExecContext(ctx, versionQuery, targetID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := getMovieForUpdate(ctx, tx, targetID, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertRevision(ctx, tx, newRevision(RevisionUpdate, locked[targetID], merged, editor))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Earlier redirects to the source now lead to the target, so that there are
+	// never chains of redirects to follow.
+	const redirectQuery = `
+		UPDATE
+			movie_redirects
+		SET
+			movie_id = $2
+		WHERE
+			movie_id = $1;`
+
+	_, err = tx.ExecContext(ctx, redirectQuery, sourceID, targetID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	const insertRedirectQuery = `
+		INSERT INTO movie_redirects (
+			id,
+			movie_id)
+		VALUES (
+			$1,
+			$2
+		);`
+
+	_, err = tx.ExecContext(ctx, insertRedirectQuery, sourceID, targetID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The rows of the source which weren't moved are deleted along with it.
+	const deleteQuery = `
+		DELETE FROM
+			movies
+		WHERE
+			id = $1;`
+
+	_, err = tx.ExecContext(ctx, deleteQuery, sourceID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertRevision(ctx, tx, newRevision(RevisionDelete, locked[sourceID], nil, editor))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return discarded, tx.Commit()
+}
+
+// GetRedirect returns the id of the movie which a merged movie was folded into.
+// ErrRecordNotFound is returned if the id wasn't merged into another movie.
+func (m MovieModel) GetRedirect(ctx context.Context, id int64) (int64, error) {
+	if id < 1 {
+		return 0, ErrRecordNotFound
+	}
+
+	const query = `
+		SELECT
+			movie_id
+		FROM
+			movie_redirects
+		WHERE
+			id = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var movieID int64
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&movieID)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+
+		return 0, err
+	}
+
+	return movieID, nil
+}
+
+// moveMovieRows moves the rows of a table from the source to the target movie,
+// skipping rows whose unique columns match a row the target already has. Without
+// any unique columns every row is moved.
+func moveMovieRows(ctx context.Context, tx *sql.Tx, table string, columns []string, sourceID int64, targetID int64) error {
+	if len(columns) == 0 {
+		query := fmt.Sprintf(`
+			UPDATE
+				%v
+			SET
+				movie_id = $2
+			WHERE
+				movie_id = $1;`, table)
+
+		_, err := tx.ExecContext(ctx, query, sourceID, targetID)
+
+		return err
+	}
+
+	conditions := make([]string, len(columns))
+
+	for i, column := range columns {
+		conditions[i] = fmt.Sprintf("AND existing.%[1]v = %[2]v.%[1]v", column, table)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE
+			%[1]v
+		SET
+			movie_id = $2
+		WHERE
+			movie_id = $1
+		AND NOT EXISTS (
+			SELECT 1 FROM %[1]v AS existing WHERE existing.movie_id = $2 %[2]v
+		);`, table, strings.Join(conditions, " "))
+
+	_, err := tx.ExecContext(ctx, query, sourceID, targetID)
+
+	return err
+}
+
+// moveMovieRelations moves the relations of the source movie to the target movie.
+// Relations are stored from both sides, so both columns are updated. Relations
+// between the two movies are dropped, since a movie can't be related to itself.
+func moveMovieRelations(ctx context.Context, tx *sql.Tx, sourceID int64, targetID int64) error {
+	const deleteQuery = `
+		DELETE FROM
+			movie_relations
+		WHERE
+			(movie_id = $1 AND related_movie_id = $2)
+		OR
+			(movie_id = $2 AND related_movie_id = $1);`
+
+	const movieQuery = `
+		UPDATE
+			movie_relations
+		SET
+			movie_id = $2
+		WHERE
+			movie_id = $1
+		AND NOT EXISTS (
+			SELECT 1 FROM movie_relations AS existing WHERE existing.movie_id = $2 AND existing.related_movie_id = movie_relations.related_movie_id
+		);`
+
+	const relatedQuery = `
+		UPDATE
+			movie_relations
+		SET
+			related_movie_id = $2
+		WHERE
+			related_movie_id = $1
+		AND NOT EXISTS (
+			SELECT 1 FROM movie_relations AS existing WHERE existing.related_movie_id = $2 AND existing.movie_id = movie_relations.movie_id
+		);`
+
+	for _, query := range []string{deleteQuery, movieQuery, relatedQuery} {
+		_, err := tx.ExecContext(ctx, query, sourceID, targetID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeMovieImages gives the target movie the poster and backdrop of the source
+// where it doesn't have its own, and returns the images of the source which
+// weren't needed.
+func mergeMovieImages(ctx context.Context, tx *sql.Tx, sourceID int64, targetID int64) ([]Image, error) {
+	var discarded []Image
+
+	for _, kind := range []string{ImagePoster, ImageBackdrop} {
+		// The column names can't be passed as placeholders, but kind is always one of
+		// the constants above.
+		selectQuery := fmt.Sprintf(`
+			SELECT
+				%[1]v_key,
+				%[1]v_urls
+			FROM
+				movies
+			WHERE
+				id = $1;`, kind)
+
+		updateQuery := fmt.Sprintf(`
+			UPDATE
+				movies
+			SET
+				%[1]v_key = $1,
+				%[1]v_urls = $2
+			WHERE
+				id = $3;`, kind)
+
+		var source, target Image
+
+		err := tx.QueryRowContext(ctx, selectQuery, sourceID).Scan(&source.Key, &source.URLs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.QueryRowContext(ctx, selectQuery, targetID).Scan(&target.Key, &target.URLs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if source.Key == "" {
+			continue
+		}
+
+		if target.Key != "" {
+			discarded = append(discarded, source)
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, updateQuery, source.Key, source.URLs, targetID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return discarded, nil
+}
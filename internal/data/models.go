@@ -3,6 +3,7 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"time"
 )
 
 // Define a custom ErrRecordNotFound error for when we do not find a record
@@ -14,13 +15,53 @@ var ErrRecordNotFound = errors.New("record not found")
 var ErrEditConflict = errors.New("edit conflict")
 
 // Create a Models struct which wraps the MovieModel. We'll add other models to this
-// like a UserModel and PermissionModel as our build progresses.
+// like a UserModel and PermissionModel as our build progresses. Movies and genres
+// are held as interfaces, so that tests can swap in the in-memory implementations.
 type Models struct {
-	Movies MovieModel
+	Collections  CollectionModel
+	ExternalIDs  ExternalIDModel
+	Genres       GenreRepository
+	Idempotency  IdempotencyModel
+	Lists        ListModel
+	Movies       MovieRepository
+	People       PersonModel
+	Permissions  PermissionModel
+	Ratings      RatingModel
+	Relations    RelationModel
+	Releases     ReleaseModel
+	Reviews      ReviewModel
+	Revisions    RevisionModel
+	Similarity   *SimilarityIndex
+	Tokens       TokenModel
+	Translations TranslationModel
+	Users        UserModel
+	WatchHistory WatchHistoryModel
 }
 
-func NewModels(db *sql.DB) Models {
+// NewModels returns the models for the database. Each query is canceled when the
+// context passed to the model method is, or when the timeout has passed, whichever
+// comes first.
+func NewModels(db *sql.DB, timeout time.Duration) Models {
+	similarity := &SimilarityIndex{DB: db, Timeout: timeout}
+
 	return Models{
-		Movies: MovieModel{DB: db},
+		Collections:  CollectionModel{DB: db, Timeout: timeout},
+		ExternalIDs:  ExternalIDModel{DB: db, Timeout: timeout},
+		Genres:       GenreModel{DB: db, Timeout: timeout},
+		Idempotency:  IdempotencyModel{DB: db, Timeout: timeout},
+		Lists:        ListModel{DB: db, Timeout: timeout},
+		Movies:       MovieModel{DB: db, Timeout: timeout, Similarity: similarity},
+		People:       PersonModel{DB: db, Timeout: timeout},
+		Permissions:  PermissionModel{DB: db, Timeout: timeout},
+		Ratings:      RatingModel{DB: db, Timeout: timeout},
+		Relations:    RelationModel{DB: db, Timeout: timeout},
+		Releases:     ReleaseModel{DB: db, Timeout: timeout},
+		Reviews:      ReviewModel{DB: db, Timeout: timeout},
+		Revisions:    RevisionModel{DB: db, Timeout: timeout},
+		Similarity:   similarity,
+		Tokens:       TokenModel{DB: db, Timeout: timeout},
+		Translations: TranslationModel{DB: db, Timeout: timeout},
+		Users:        UserModel{DB: db, Timeout: timeout},
+		WatchHistory: WatchHistoryModel{DB: db, Timeout: timeout},
 	}
 }
@@ -0,0 +1,155 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// MovieStats summarises the movies in the catalogue which match a set of filters.
+// The runtimes are rounded to the nearest minute, and the years are 0 when no
+// movies match.
+type MovieStats struct {
+	TotalMovies    int            `json:"total_movies"`
+	AverageRuntime Runtime        `json:"average_runtime"`
+	MedianRuntime  Runtime        `json:"median_runtime"`
+	OldestYear     int32          `json:"oldest_year,omitzero"`
+	NewestYear     int32          `json:"newest_year,omitzero"`
+	Genres         []*GenreCount  `json:"genres"`
+	Decades        []*DecadeCount `json:"decades"`
+}
+
+// A DecadeCount is the number of movies released in a decade, like the 1990s.
+type DecadeCount struct {
+	Decade int32 `json:"decade"`
+	Count  int   `json:"count"`
+}
+
+// GetStats returns statistics for the movies which match the same title, genres and
+// country filters as GetAll(). The statistics are read in a single snapshot, so
+// the totals and the breakdowns always agree.
+func (m MovieModel) GetStats(ctx context.Context, title string, genres []string, country string) (*MovieStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	args := []any{title, pq.Array(genres), country}
+
+	totalsQuery := fmt.Sprintf(`
+		SELECT
+			COUNT(*),
+			COALESCE(ROUND(AVG(runtime)), 0)::integer,
+			COALESCE(ROUND(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY runtime)), 0)::integer,
+			COALESCE(MIN(year), 0),
+			COALESCE(MAX(year), 0)
+		FROM
+			movies
+		WHERE %v;`, movieFilterConditions)
+
+	stats := MovieStats{
+		Genres:  []*GenreCount{},
+		Decades: []*DecadeCount{},
+	}
+
+	err = tx.QueryRowContext(ctx, totalsQuery, args...).Scan(
+		&stats.TotalMovies,
+		&stats.AverageRuntime,
+		&stats.MedianRuntime,
+		&stats.OldestYear,
+		&stats.NewestYear,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Each movie counts once towards every one of its genres.
+	genresQuery := fmt.Sprintf(`
+		SELECT
+			genres.slug,
+			genres.name,
+			COUNT(*) AS count
+		FROM
+			movies
+		INNER JOIN
+			movies_genres ON movies_genres.movie_id = movies.id
+		INNER JOIN
+			genres ON genres.id = movies_genres.genre_id
+		WHERE %v
+		GROUP BY
+			genres.id
+		ORDER BY
+			count DESC,
+			genres.name ASC;`, movieFilterConditions)
+
+	rows, err := tx.QueryContext(ctx, genresQuery, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var genre GenreCount
+
+		err := rows.Scan(&genre.Slug, &genre.Name, &genre.Count)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stats.Genres = append(stats.Genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	decadesQuery := fmt.Sprintf(`
+		SELECT
+			year / 10 * 10 AS decade,
+			COUNT(*)
+		FROM
+			movies
+		WHERE %v
+		GROUP BY
+			decade
+		ORDER BY
+			decade ASC;`, movieFilterConditions)
+
+	rows, err = tx.QueryContext(ctx, decadesQuery, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var decade DecadeCount
+
+		err := rows.Scan(&decade.Decade, &decade.Count)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stats.Decades = append(stats.Decades, &decade)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
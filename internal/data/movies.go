@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -20,39 +22,89 @@ type Movie struct {
 	Runtime Runtime  `json:"runtime,omitzero"` // use the custom Runtime type so we get the custom marhsalling logic
 	Genres  []string `json:"genres,omitzero"`
 	Version int32    `json:"version"`
+	// The average rating out of 10 and the number of ratings it is based on. They
+	// are maintained by the database as users rate the movie.
+	Rating      float64 `json:"rating,omitzero"`
+	RatingCount int32   `json:"rating_count,omitzero"`
+	// The URLs of the uploaded poster and backdrop images, keyed by size.
+	Poster   ImageURLs `json:"poster,omitzero"`
+	Backdrop ImageURLs `json:"backdrop,omitzero"`
+	// The locale of the translated title and overview. Both are only set when the
+	// movie was read in a locale which it has a translation for, otherwise the
+	// title is the original title.
+	Locale   string `json:"locale,omitzero"`
+	Overview string `json:"overview,omitzero"`
+	// The ids of the movie in other catalogues, keyed by source like "imdb".
+	ExternalIDs ExternalIDs `json:"external_ids,omitzero"`
+	// Credits are only loaded when requested with ?include=credits. An empty list
+	// is still encoded, so that a movie without credits can be told apart.
+	Credits []*Credit `json:"credits,omitzero"`
 }
 
-func ValidateMovie(v *validator.Validator, movie *Movie) {
+// ValidateMovie checks the movie fields, including that every genre finds one of the
+// known genres with GenreSet.Find(). Genres which find the same genre, like "Sci-Fi"
+// and "sci-fi", are duplicates of each other.
+func ValidateMovie(v *validator.Validator, movie *Movie, genres GenreSet) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(movie.Year != 0, "year", "must be provided")
 	v.Check(movie.Runtime != 0, "runtime", "must be provided")
 	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
 	v.Check(len(movie.Genres) >= 1, "genres", "must have at least 1 genre")
 	v.Check(len(movie.Genres) <= 5, "genres", "must have no more than 5 genres")
-	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicates")
+
+	// Unknown genres are compared by their slug instead.
+	keys := make([]string, len(movie.Genres))
+
+	for i, name := range movie.Genres {
+		keys[i] = "slug:" + Slugify(name)
+
+		if genre := genres.Find(name); genre != nil {
+			keys[i] = fmt.Sprintf("id:%d", genre.ID)
+		}
+	}
+
+	v.Check(validator.Unique(keys), "genres", "must not contain duplicates")
+
+	for _, genre := range movie.Genres {
+		v.Check(genres.Contains(genre), "genres", fmt.Sprintf("must only contain known genres (%q is unknown)", genre))
+	}
+
+	for source, id := range movie.ExternalIDs {
+		ValidateExternalID(v, "external_ids", source, id)
+	}
+}
+
+// ValidateExternalID checks that the source of an external id is known and that the
+// id is in that source's format. Errors are added under the given key.
+func ValidateExternalID(v *validator.Validator, key string, source string, id string) {
+	_, ok := validator.ExternalIDRX[source]
+
+	v.Check(ok, key, fmt.Sprintf("%q is not a known source (must be imdb or tmdb)", source))
+	v.Check(!ok || validator.ExternalID(source, id), key, fmt.Sprintf("%q is not a valid %v id", id, source))
 }
 
 // Define a MovieModel struct type which wraps a sql.DB connection pool.
 type MovieModel struct {
-	DB *sql.DB
+	DB         *sql.DB
+	Timeout    time.Duration
+	Similarity *SimilarityIndex
 }
 
 // The insert method accepts a pointer to a movie struct which should contain the
-// data for the new record.
-func (m MovieModel) Insert(movie *Movie) error {
+// data for the new record. The insert and its revision are written in a single
+// transaction, with the editor recorded as the acting user.
+func (m MovieModel) Insert(ctx context.Context, movie *Movie, editor Editor) error {
 	// Define a sql query for inserting a new record in the movies table and returning
 	// the system-generated data.
 	const query = `
 		INSERT INTO movies (
 			title,
 			year,
-			runtime,
-			genres)
+			runtime)
 		VALUES (
 			$1,
 			$2,
-			$3,
-			$4
+			$3
 		)
 		RETURNING 
 			id,
@@ -62,15 +114,52 @@ func (m MovieModel) Insert(movie *Movie) error {
 	// Create an args slice containing the values for the placeholder parameters from
 	// the movie struct. Declaring this slice immediately next to our sql query helps to
 	// make it nice and clear *what values are being used where* in the query.
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	args := []any{movie.Title, movie.Year, movie.Runtime}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	// Use the QueryRow() method to execute the sql query on our connection pool
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	// Rollback() is a no-op once the transaction has been committed, so it is safe
+	// to always defer it.
+	defer tx.Rollback()
+
+	// Use the QueryRow() method to execute the sql query inside the transaction
 	// passing in the args slice as a variadic parameter and scanning the system-
 	// generated id, created_at and version values into the movie struct.
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+
+	if err != nil {
+		return err
+	}
+
+	// The genres are stored in the movies_genres join table.
+	err = setMovieGenres(ctx, tx, movie)
+
+	if err != nil {
+		return err
+	}
+
+	// ErrDuplicateExternalID is returned if one of the external ids is already mapped
+	// to another movie, and nothing is inserted.
+	err = insertExternalIDs(ctx, tx, movie)
+
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(ctx, tx, newRevision(RevisionInsert, nil, movie, editor))
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 
 	// You did not have to create an args array of course. We could pass the
 	// placeholder values like so.
@@ -122,7 +211,7 @@ func (m MovieModel) Insert(movie *Movie) error {
 // }
 
 // Example to show cancellation of long running sql queries using context.
-func (m MovieModel) Get(id int64) (*Movie, error) {
+func (m MovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
@@ -136,8 +225,13 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 			title,
 			year,
 			runtime,
-			genres,
-			version
+			movie_genres(id) AS genres,
+			version,
+			rating,
+			rating_count,
+			poster_urls,
+			backdrop_urls,
+			movie_external_ids(id) AS external_ids
 		FROM
 			movies
 		WHERE
@@ -145,10 +239,10 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 
 	var movie Movie
 
-	// Use context.WithTimeout() to create a context.Context which carries a
-	// 3 second timeout deadline.
-	// Note that we're using the empty context.Background() as the parent context.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Use context.WithTimeout() to create a context.Context which carries the
+	// query timeout deadline. The parent context is the one passed in by the
+	// caller, so the query is also canceled when the client goes away.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 
 	// Use defer to make sure we cancel the context before the Get()
 	// method returns
@@ -164,6 +258,11 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
 		&movie.Version,
+		&movie.Rating,
+		&movie.RatingCount,
+		&movie.Poster,
+		&movie.Backdrop,
+		&movie.ExternalIDs,
 	)
 
 	// so we also check if the error is actually a no rows found error
@@ -179,7 +278,253 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
+// Exists reports whether a movie with the id exists, without reading it.
+func (m MovieModel) Exists(ctx context.Context, id int64) (bool, error) {
+	if id < 1 {
+		return false, nil
+	}
+
+	const query = `
+		SELECT EXISTS (
+			SELECT 1 FROM movies WHERE id = $1
+		);`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var exists bool
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&exists)
+
+	return exists, err
+}
+
+// GetLocalized returns a movie like Get(), but with the title and overview of the
+// first of the locales which the movie has a translation for. The locales should
+// be in order of preference, and if none of them match the original title is kept.
+// Movies read this way are for display only and mustn't be passed to Update().
+func (m MovieModel) GetLocalized(ctx context.Context, id int64, locales []string) (*Movie, error) {
+	movie, err := m.Get(ctx, id)
+
+	if err != nil || len(locales) == 0 {
+		return movie, err
+	}
+
+	const query = `
+		SELECT
+			locale,
+			title,
+			overview
+		FROM
+			movie_translations
+		WHERE
+			movie_id = $1
+		AND
+			locale = ANY($2::text[])
+		ORDER BY
+			array_position($2::text[], locale)
+		LIMIT 1;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, id, pq.Array(locales)).Scan(&movie.Locale, &movie.Title, &movie.Overview)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return movie, nil
+}
+
+// InsertBatch inserts several movies with a single multi-row INSERT statement. The
+// movies and their revisions are written in one transaction, so either all of them
+// are inserted or none are. The system-generated id, created_at and version values
+// are set on each movie.
+func (m MovieModel) InsertBatch(ctx context.Context, movies []*Movie, editor Editor) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = insertMovies(ctx, tx, movies, editor)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// The number of movies inserted together by Import().
+const importBatchSize = 500
+
+// Import inserts the movies in a single transaction, in batches of importBatchSize,
+// so either all of them are imported or none are. The movies must already have been
+// read and validated, so that the transaction isn't held open while they are being
+// uploaded.
+func (m MovieModel) Import(ctx context.Context, movies []*Movie, editor Editor) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	// An import can insert many more rows than a regular query, so we allow it up to
+	// five minutes, like an export.
+	ctx, cancel := context.WithTimeout(ctx, max(m.Timeout, 5*time.Minute))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for batch := range slices.Chunk(movies, importBatchSize) {
+		err = insertMovies(ctx, tx, batch, editor)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// The insertMovies() helper inserts the movies and their genres and revisions in
+// tx, and sets the system-generated id, created_at and version values on each
+// movie.
+func insertMovies(ctx context.Context, tx *sql.Tx, movies []*Movie, editor Editor) error {
+	// Pass the movies as parallel arrays of titles, years and runtimes.
+	titles := make([]string, len(movies))
+	years := make([]int64, len(movies))
+	runtimes := make([]int64, len(movies))
+
+	for i, movie := range movies {
+		titles[i] = movie.Title
+		years[i] = int64(movie.Year)
+		runtimes[i] = int64(movie.Runtime)
+	}
+
+	// Postgres doesn't guarantee that the ids of a multi-row INSERT are drawn from
+	// the sequence in the order of the input rows, nor that RETURNING returns them
+	// in that order. So the input CTE draws the id for each row along with its
+	// position in the arrays (WITH ORDINALITY), and the inserted rows are joined back
+	// to it to return the position of each one. Since nextval() is volatile, the
+	// CTE is only evaluated once.
+	const query = `
+		WITH input AS (
+			SELECT
+				nextval(pg_get_serial_sequence('movies', 'id')) AS id,
+				input.title,
+				input.year,
+				input.runtime,
+				input.ordinal
+			FROM
+				UNNEST($1::text[], $2::integer[], $3::integer[]) WITH ORDINALITY AS input(title, year, runtime, ordinal)
+		), inserted AS (
+			INSERT INTO movies (
+				id,
+				title,
+				year,
+				runtime)
+			SELECT
+				id,
+				title,
+				year,
+				runtime
+			FROM
+				input
+			RETURNING
+				id,
+				created_at,
+				version
+		)
+		SELECT
+			input.ordinal,
+			inserted.id,
+			inserted.created_at,
+			inserted.version
+		FROM
+			inserted
+		INNER JOIN
+			input ON input.id = inserted.id;`
+
+	result, err := tx.QueryContext(ctx, query, pq.Array(titles), pq.Array(years), pq.Array(runtimes))
+
+	if err != nil {
+		return err
+	}
+
+	defer result.Close()
+
+	inserted := 0
+
+	for result.Next() {
+		var ordinal int
+		var movie Movie
+
+		err := result.Scan(&ordinal, &movie.ID, &movie.CreatedAt, &movie.Version)
+
+		if err != nil {
+			return err
+		}
+
+		// The ordinal counts from 1.
+		movies[ordinal-1].ID = movie.ID
+		movies[ordinal-1].CreatedAt = movie.CreatedAt
+		movies[ordinal-1].Version = movie.Version
+
+		inserted++
+	}
+
+	if err = result.Err(); err != nil {
+		return err
+	}
+
+	if inserted != len(movies) {
+		return fmt.Errorf("inserted %d movies but expected %d", inserted, len(movies))
+	}
+
+	err = insertMoviesGenres(ctx, tx, movies)
+
+	if err != nil {
+		return err
+	}
+
+	revisions := make([]*Revision, len(movies))
+
+	for i, movie := range movies {
+		revisions[i] = newRevision(RevisionInsert, nil, movie, editor)
+	}
+
+	return insertRevisions(ctx, tx, revisions)
+}
+
+// placeholders returns a parenthesised list of n query placeholders starting at
+// $start, for example "($5, $6, $7)".
+func placeholders(start int, n int) string {
+	parts := make([]string, n)
+
+	for i := range parts {
+		parts[i] = fmt.Sprintf("$%d", start+i)
+	}
+
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func (m MovieModel) Update(ctx context.Context, movie *Movie, editor Editor) error {
 	// Change the update query to include the version number to avoid data races.
 	// We call this approach optimistic locking.
 	// If we can't find a record with a matching id and version number we will return
@@ -191,12 +536,11 @@ func (m MovieModel) Update(movie *Movie) error {
 			title = $1,
 			year = $2,
 			runtime = $3,
-			genres = $4,
 			version = version + 1
 		WHERE 
-			id = $5
+			id = $4
 		AND
-			version = $6
+			version = $5
 		RETURNING 
 			version;`
 
@@ -204,15 +548,35 @@ func (m MovieModel) Update(movie *Movie) error {
 		movie.Title,
 		movie.Year,
 		movie.Runtime,
-		pq.Array(movie.Genres),
 		movie.ID,
 		movie.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// Lock the row and read its current values so they can be stored as the old
+	// values of the revision. If the version no longer matches we have an edit
+	// conflict, just like when the update itself matches no rows.
+	old, err := getMovieForUpdate(ctx, tx, movie.ID, movie.Version)
+
+	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) {
+			return ErrEditConflict
+		}
+
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 
 	if err != nil {
 		// We will return this error if no record was found.
@@ -226,69 +590,221 @@ func (m MovieModel) Update(movie *Movie) error {
 		return err
 	}
 
-	return nil
+	err = setMovieGenres(ctx, tx, movie)
+
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(ctx, tx, newRevision(RevisionUpdate, old, movie, editor))
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m MovieModel) Delete(id int64) error {
+// Delete deletes a movie and records the deletion as a revision. The poster and
+// backdrop of the movie are returned, so that their files can be removed.
+func (m MovieModel) Delete(ctx context.Context, id int64, editor Editor) ([]Image, error) {
 	if id < 1 {
-		return ErrRecordNotFound
+		return nil, ErrRecordNotFound
 	}
 
 	const query = `
 		DELETE FROM
 			movies
 		WHERE
-			id = $1;`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			id = $1
+		RETURNING
+			poster_key,
+			poster_urls,
+			backdrop_key,
+			backdrop_urls;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	sqlRes, err := m.DB.ExecContext(ctx, query, id)
+	tx, err := m.DB.BeginTx(ctx, nil)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rowsAffected, err := sqlRes.RowsAffected()
+	defer tx.Rollback()
+
+	// Read the movie before deleting it so it can be stored as the old values of the
+	// revision.
+	old, err := getMovieForUpdate(ctx, tx, id, 0)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	var poster, backdrop Image
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&poster.Key, &poster.URLs, &backdrop.Key, &backdrop.URLs)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	err = insertRevision(ctx, tx, newRevision(RevisionDelete, old, nil, editor))
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var images []Image
+
+	for _, image := range []Image{poster, backdrop} {
+		if image.Key != "" {
+			images = append(images, image)
+		}
+	}
+
+	return images, nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, *Metadata, error) {
-	query := fmt.Sprintf(`
+// getMovieForUpdate reads a movie with a matching id and version inside a
+// transaction and locks the row until the transaction ends. A version of 0 matches
+// any version. The rating isn't read, since it isn't recorded in revisions.
+func getMovieForUpdate(ctx context.Context, tx *sql.Tx, id int64, version int32) (*Movie, error) {
+	const query = `
 		SELECT
-			COUNT(*) OVER(),
 			id,
 			created_at,
 			title,
 			year,
 			runtime,
-			genres,
-			version
+			movie_genres(id) AS genres,
+			version,
+			poster_urls,
+			backdrop_urls,
+			movie_external_ids(id) AS external_ids
 		FROM
-			Movies
-		WHERE 
-			($1::text IS NULL OR $1::text = '' OR LOWER(title) = LOWER($1::text))
-		AND 
-			($2::text[] IS NULL OR array_length($2::text[], 1) = 0 OR genres @> $2::text[])
-		ORDER BY %v %v
-		LIMIT $3
-		OFFSET $4;`, filters.sortColumn(), filters.sortDirection())
+			movies
+		WHERE
+			id = $1
+		AND
+			($2 = 0 OR version = $2)
+		FOR UPDATE;`
+
+	var movie Movie
+
+	err := tx.QueryRowContext(ctx, query, id, version).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.Poster,
+		&movie.Backdrop,
+		&movie.ExternalIDs,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	return &movie, nil
+}
+
+// The conditions shared by every query which filters movies by title ($1), genre
+// names ($2) and release country ($3). An empty title, genres list or country
+// matches all movies. The title is always matched against the original title.
+//
+// Each name in $2 is matched to a genre with find_genre(), in the same way as the
+// genres of a movie which is written. A movie has every genre in $2 when it has as
+// many of them as there are distinct genres found. An unknown name counts as a
+// genre which no movie has, so it matches no movies. Starting from the genres
+// means the index on movies_genres.genre_id is used, rather than reading the
+// genres of every movie.
+const movieFilterConditions = `
+			($1::text IS NULL OR $1::text = '' OR LOWER(movies.title) = LOWER($1::text))
+		AND 
+			($2::text[] IS NULL OR cardinality($2::text[]) = 0 OR movies.id IN (
+				SELECT
+					movies_genres.movie_id
+				FROM
+					movies_genres
+				WHERE
+					movies_genres.genre_id IN (SELECT find_genre(name) FROM UNNEST($2::text[]) AS name)
+				GROUP BY
+					movies_genres.movie_id
+				HAVING
+					COUNT(*) = (SELECT COUNT(DISTINCT COALESCE(find_genre(name), 0)) FROM UNNEST($2::text[]) AS name)
+			))
+		AND
+			($3::text = '' OR EXISTS (
+				SELECT 1 FROM movie_releases WHERE movie_releases.movie_id = movies.id AND movie_releases.country = $3::text
+			))`
+
+// GetAll returns a page of the movies matching the filters. Each movie is given the
+// title and overview of the first of the locales it has a translation for, in the
+// same way as GetLocalized(), and sorting by title uses the translated title.
+func (m MovieModel) GetAll(ctx context.Context, title string, genres []string, country string, locales []string, filters Filters) ([]*Movie, *Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*) OVER(),
+			movies.id AS id,
+			movies.created_at,
+			COALESCE(translation.title, movies.title) AS title,
+			movies.year AS year,
+			movies.runtime AS runtime,
+			movie_genres(movies.id) AS genres,
+			movies.version,
+			movies.rating AS rating,
+			movies.rating_count,
+			movies.poster_urls,
+			movies.backdrop_urls,
+			movie_external_ids(movies.id) AS external_ids,
+			COALESCE(translation.locale, ''),
+			COALESCE(translation.overview, '')
+		FROM
+			movies
+		LEFT JOIN LATERAL (
+			SELECT
+				locale,
+				title,
+				overview
+			FROM
+				movie_translations
+			WHERE
+				movie_id = movies.id
+			AND
+				locale = ANY($4::text[])
+			ORDER BY
+				array_position($4::text[], locale)
+			LIMIT 1
+		) translation ON TRUE
+		WHERE %v
+		ORDER BY %v %v, id ASC
+		LIMIT $5
+		OFFSET $6;`, movieFilterConditions, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
+	// The genres are matched by slug, like when validating a movie.
 	args := []any{
 		title,
 		pq.Array(genres),
+		country,
+		pq.Array(locales),
 		filters.limit(),
 		filters.offset(),
 	}
@@ -324,6 +840,13 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.Poster,
+			&movie.Backdrop,
+			&movie.ExternalIDs,
+			&movie.Locale,
+			&movie.Overview,
 		)
 
 		if err != nil {
@@ -344,3 +867,115 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 
 	return movies, &metadata, nil
 }
+
+// The number of rows fetched from the export cursor at a time. Only this many
+// movies are held in memory, regardless of the size of the catalogue.
+const exportBatchSize = 500
+
+// Export calls fn for every movie which matches the title, genres and country filters, in
+// the order given by the filters. The rows are read through a server-side cursor
+// in batches of exportBatchSize, so the whole result set is never loaded at once.
+// The page and page size of the filters are ignored.
+func (m MovieModel) Export(ctx context.Context, title string, genres []string, country string, filters Filters, fn func(*Movie) error) error {
+	query := fmt.Sprintf(`
+		DECLARE movies_export NO SCROLL CURSOR FOR
+		SELECT
+			id,
+			created_at,
+			title,
+			year,
+			runtime,
+			movie_genres(id) AS genres,
+			version,
+			rating,
+			rating_count,
+			poster_urls,
+			backdrop_urls,
+			movie_external_ids(id) AS external_ids
+		FROM
+			movies
+		WHERE %v
+		ORDER BY %v %v, id ASC;`, movieFilterConditions, filters.sortColumn(), filters.sortDirection())
+
+	// An export can take much longer than a regular query, so we allow it up to
+	// five minutes.
+	ctx, cancel := context.WithTimeout(ctx, max(m.Timeout, 5*time.Minute))
+	defer cancel()
+
+	// Cursors only exist inside a transaction. Rolling it back at the end closes
+	// the cursor.
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query, title, pq.Array(genres), country)
+
+	if err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM movies_export;", exportBatchSize)
+
+	for {
+		n, err := fetchMovies(ctx, tx, fetch, fn)
+
+		if err != nil {
+			return err
+		}
+
+		if n < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// fetchMovies runs a FETCH statement against a cursor and calls fn for each of the
+// returned movies. It returns the number of movies fetched.
+func fetchMovies(ctx context.Context, tx *sql.Tx, fetch string, fn func(*Movie) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fetch)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	n := 0
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.Poster,
+			&movie.Backdrop,
+			&movie.ExternalIDs,
+		)
+
+		if err != nil {
+			return n, err
+		}
+
+		n++
+
+		err = fn(&movie)
+
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, rows.Err()
+}
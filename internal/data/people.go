@@ -0,0 +1,306 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// Define a custom ErrDuplicateCredit error for when the same person is credited
+// twice with the same role (and character) on a movie.
+var ErrDuplicateCredit = errors.New("duplicate credit")
+
+// Define constants for the roles a person can be credited with on a movie.
+const (
+	RoleDirector = "director"
+	RoleWriter   = "writer"
+	RoleActor    = "actor"
+)
+
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	BirthYear int32     `json:"birth_year,omitzero"`
+	Version   int32     `json:"version"`
+}
+
+// A Credit links a person to a movie in a specific role. Character is only set for
+// actors, and credits are listed in billing order within each role.
+type Credit struct {
+	ID           int64  `json:"id"`
+	MovieID      int64  `json:"-"`
+	PersonID     int64  `json:"person_id"`
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitzero"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(person.BirthYear >= 0, "birth_year", "must be a positive integer")
+	v.Check(person.BirthYear <= int32(time.Now().Year()), "birth_year", "must not be in the future")
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", "must be provided")
+	v.Check(validator.PermittedValue(credit.Role, RoleDirector, RoleWriter, RoleActor), "role", "must be director, writer or actor")
+	v.Check(credit.Role == RoleActor || credit.Character == "", "character", "must only be provided for actors")
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must not be negative")
+}
+
+// Define a PersonModel struct type which wraps a sql.DB connection pool. It manages
+// both people and the credits which link them to movies.
+type PersonModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+func (m PersonModel) Insert(ctx context.Context, person *Person) error {
+	const query = `
+		INSERT INTO people (
+			name,
+			birth_year)
+		VALUES (
+			$1,
+			NULLIF($2, 0)
+		)
+		RETURNING
+			id,
+			created_at,
+			version;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, person.Name, person.BirthYear).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (m PersonModel) Get(ctx context.Context, id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	const query = `
+		SELECT
+			id,
+			created_at,
+			name,
+			COALESCE(birth_year, 0),
+			version
+		FROM
+			people
+		WHERE
+			id = $1;`
+
+	var person Person
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Name,
+		&person.BirthYear,
+		&person.Version,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &person, nil
+}
+
+// GetAll returns a page of people whose name contains the given name, ignoring case.
+func (m PersonModel) GetAll(ctx context.Context, name string, filters Filters) ([]*Person, *Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*) OVER(),
+			id,
+			created_at,
+			name,
+			COALESCE(birth_year, 0),
+			version
+		FROM
+			people
+		WHERE
+			($1 = '' OR name ILIKE '%%' || $1 || '%%')
+		ORDER BY %v %v, id ASC
+		LIMIT $2
+		OFFSET $3;`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+
+	if err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	people := []*Person{}
+
+	totalRecords := 0
+
+	for rows.Next() {
+		var person Person
+
+		err := rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.BirthYear,
+			&person.Version,
+		)
+
+		if err != nil {
+			return nil, &Metadata{}, err
+		}
+
+		people = append(people, &person)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return people, &metadata, nil
+}
+
+// InsertCredit credits a person on a movie. ErrRecordNotFound is returned if the
+// person doesn't exist.
+func (m PersonModel) InsertCredit(ctx context.Context, credit *Credit) error {
+	const query = `
+		WITH inserted AS (
+			INSERT INTO movie_credits (
+				movie_id,
+				person_id,
+				role,
+				character,
+				billing_order)
+			VALUES (
+				$1,
+				$2,
+				$3,
+				$4,
+				$5
+			)
+			RETURNING
+				id,
+				person_id
+		)
+		SELECT
+			inserted.id,
+			people.name
+		FROM
+			inserted
+		INNER JOIN
+			people ON people.id = inserted.person_id;`
+
+	args := []any{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&credit.ID, &credit.Name)
+
+	if err != nil {
+		var pqError *pq.Error
+
+		if errors.As(err, &pqError) {
+			switch pqError.Constraint {
+			case "movie_credits_person_id_fkey", "movie_credits_movie_id_fkey":
+				return ErrRecordNotFound
+			case "movie_credits_unique_key":
+				return ErrDuplicateCredit
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// GetCreditsForMovies returns the credits of several movies, keyed by movie id,
+// using a single query. Movies without credits have no entry in the map.
+func (m PersonModel) GetCreditsForMovies(ctx context.Context, movieIDs []int64) (map[int64][]*Credit, error) {
+	const query = `
+		SELECT
+			movie_credits.id,
+			movie_credits.movie_id,
+			movie_credits.person_id,
+			people.name,
+			movie_credits.role,
+			movie_credits.character,
+			movie_credits.billing_order
+		FROM
+			movie_credits
+		INNER JOIN
+			people ON people.id = movie_credits.person_id
+		WHERE
+			movie_credits.movie_id = ANY($1)
+		ORDER BY
+			movie_credits.movie_id,
+			CASE movie_credits.role WHEN 'director' THEN 1 WHEN 'writer' THEN 2 ELSE 3 END,
+			movie_credits.billing_order,
+			movie_credits.id;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	credits := map[int64][]*Credit{}
+
+	for rows.Next() {
+		var credit Credit
+
+		err := rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Name,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		credits[credit.MovieID] = append(credits[credit.MovieID], &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
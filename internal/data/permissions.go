@@ -0,0 +1,79 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+)
+
+// Define constants for the permission codes stored in the permissions table.
+const (
+	// The catalogue:write permission covers the data kept alongside movies, like
+	// people and credits, which any client can read.
+	PermissionCatalogueWrite  = "catalogue:write"
+	PermissionGenresWrite     = "genres:write"
+	PermissionMoviesImport    = "movies:import"
+	PermissionMoviesMerge     = "movies:merge"
+	PermissionReviewsModerate = "reviews:moderate"
+)
+
+// Permissions holds the permission codes granted to a single user, like
+// "genres:write".
+type Permissions []string
+
+// Include checks whether the Permissions slice contains a specific permission code.
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+// Define a PermissionModel struct type which wraps a sql.DB connection pool.
+type PermissionModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// GetAllForUser returns all the permission codes granted to a specific user.
+// Permissions are granted directly in the users_permissions table.
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	const query = `
+		SELECT
+			permissions.code
+		FROM
+			permissions
+		INNER JOIN
+			users_permissions ON users_permissions.permission_id = permissions.id
+		WHERE
+			users_permissions.user_id = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1,307 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// An orderedMovies describes a table of movies ordered by a position column within
+// a parent record, like the items of a list or the movies of a collection. The
+// table must have movie_id and position columns, with positions starting at 1
+// and a deferred unique constraint on (parent, position).
+//
+// The parent row is locked by each change, so that changes to the positions within
+// one parent are made one at a time. Every method must be called inside a
+// transaction.
+type orderedMovies struct {
+	parentTable  string
+	table        string
+	parentColumn string
+}
+
+// lock locks the parent record until the transaction ends and returns the last
+// position used, or 0 if there are no movies. ErrRecordNotFound is returned if the
+// parent doesn't exist.
+func (o orderedMovies) lock(ctx context.Context, tx *sql.Tx, parentID int64) (int32, error) {
+	lockQuery := fmt.Sprintf(`
+		SELECT
+			id
+		FROM
+			%v
+		WHERE
+			id = $1
+		FOR UPDATE;`, o.parentTable)
+
+	err := tx.QueryRowContext(ctx, lockQuery, parentID).Scan(&parentID)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+
+		return 0, err
+	}
+
+	lastQuery := fmt.Sprintf(`
+		SELECT
+			COALESCE(MAX(position), 0)
+		FROM
+			%v
+		WHERE
+			%v = $1;`, o.table, o.parentColumn)
+
+	var last int32
+
+	err = tx.QueryRowContext(ctx, lastQuery, parentID).Scan(&last)
+
+	return last, err
+}
+
+// position returns the current position of a movie. ErrRecordNotFound is returned
+// if the movie isn't in the parent.
+func (o orderedMovies) position(ctx context.Context, tx *sql.Tx, parentID int64, movieID int64) (int32, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			position
+		FROM
+			%v
+		WHERE
+			%v = $1
+		AND
+			movie_id = $2;`, o.table, o.parentColumn)
+
+	var position int32
+
+	err := tx.QueryRowContext(ctx, query, parentID, movieID).Scan(&position)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+
+		return 0, err
+	}
+
+	return position, nil
+}
+
+// insert adds a movie at the given position, moving the movies from that position
+// onwards down by one, and returns the position used. A position of 0, or one past
+// the end, appends the movie. ErrRecordNotFound is returned if the movie doesn't
+// exist, and errDuplicate if the parent already contains it.
+func (o orderedMovies) insert(ctx context.Context, tx *sql.Tx, parentID int64, movieID int64, position int32, errDuplicate error) (int32, error) {
+	last, err := o.lock(ctx, tx, parentID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if position == 0 || position > last {
+		position = last + 1
+	}
+
+	shiftQuery := fmt.Sprintf(`
+		UPDATE
+			%v
+		SET
+			position = position + 1
+		WHERE
+			%v = $1
+		AND
+			position >= $2;`, o.table, o.parentColumn)
+
+	_, err = tx.ExecContext(ctx, shiftQuery, parentID, position)
+
+	if err != nil {
+		return 0, err
+	}
+
+	insertQuery := fmt.Sprintf(`
+		INSERT INTO %v (
+			%v,
+			movie_id,
+			position)
+		VALUES (
+			$1,
+			$2,
+			$3
+		);`, o.table, o.parentColumn)
+
+	_, err = tx.ExecContext(ctx, insertQuery, parentID, movieID, position)
+
+	if err != nil {
+		var pqError *pq.Error
+
+		if errors.As(err, &pqError) {
+			switch pqError.Constraint {
+			case o.table + "_movie_id_fkey":
+				return 0, ErrRecordNotFound
+			case o.table + "_pkey":
+				return 0, errDuplicate
+			}
+		}
+
+		return 0, err
+	}
+
+	return position, nil
+}
+
+// move moves a movie to a new position, shifting the movies in between by one, and
+// returns the position used. A position past the end moves the movie to the end.
+// ErrRecordNotFound is returned if the movie isn't in the parent.
+func (o orderedMovies) move(ctx context.Context, tx *sql.Tx, parentID int64, movieID int64, position int32) (int32, error) {
+	last, err := o.lock(ctx, tx, parentID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	current, err := o.position(ctx, tx, parentID, movieID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if position == 0 || position > last {
+		position = last
+	}
+
+	// Every movie between the current and the new position moves one place towards
+	// the current position, and the moved movie takes the new position.
+	query := fmt.Sprintf(`
+		UPDATE
+			%v
+		SET
+			position = CASE
+				WHEN movie_id = $2 THEN $4::integer
+				WHEN $4::integer < $3::integer THEN position + 1
+				ELSE position - 1
+			END
+		WHERE
+			%v = $1
+		AND
+			position BETWEEN LEAST($3::integer, $4::integer) AND GREATEST($3::integer, $4::integer);`, o.table, o.parentColumn)
+
+	_, err = tx.ExecContext(ctx, query, parentID, movieID, current, position)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return position, nil
+}
+
+// remove removes a movie and closes the gap it leaves behind. ErrRecordNotFound is
+// returned if the movie isn't in the parent.
+func (o orderedMovies) remove(ctx context.Context, tx *sql.Tx, parentID int64, movieID int64) error {
+	_, err := o.lock(ctx, tx, parentID)
+
+	if err != nil {
+		return err
+	}
+
+	current, err := o.position(ctx, tx, parentID, movieID)
+
+	if err != nil {
+		return err
+	}
+
+	deleteQuery := fmt.Sprintf(`
+		DELETE FROM
+			%v
+		WHERE
+			%v = $1
+		AND
+			movie_id = $2;`, o.table, o.parentColumn)
+
+	_, err = tx.ExecContext(ctx, deleteQuery, parentID, movieID)
+
+	if err != nil {
+		return err
+	}
+
+	shiftQuery := fmt.Sprintf(`
+		UPDATE
+			%v
+		SET
+			position = position - 1
+		WHERE
+			%v = $1
+		AND
+			position > $2;`, o.table, o.parentColumn)
+
+	_, err = tx.ExecContext(ctx, shiftQuery, parentID, current)
+
+	return err
+}
+
+// replace swaps one movie for another in every parent which contains it, keeping
+// its position. Where a parent already contains the new movie the old one is
+// removed instead, closing the gap it leaves behind.
+func (o orderedMovies) replace(ctx context.Context, tx *sql.Tx, oldMovieID int64, newMovieID int64) error {
+	bothQuery := fmt.Sprintf(`
+		SELECT
+			%[2]v
+		FROM
+			%[1]v
+		WHERE
+			movie_id = $1
+		AND
+			%[2]v IN (SELECT %[2]v FROM %[1]v WHERE movie_id = $2)
+		ORDER BY
+			%[2]v ASC;`, o.table, o.parentColumn)
+
+	rows, err := tx.QueryContext(ctx, bothQuery, oldMovieID, newMovieID)
+
+	if err != nil {
+		return err
+	}
+
+	// The rows must be read and closed before the parents are changed, since a
+	// transaction can only run one query at a time.
+	var parentIDs []int64
+
+	for rows.Next() {
+		var parentID int64
+
+		err := rows.Scan(&parentID)
+
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		parentIDs = append(parentIDs, parentID)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, parentID := range parentIDs {
+		err = o.remove(ctx, tx, parentID, oldMovieID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	updateQuery := fmt.Sprintf(`
+		UPDATE
+			%v
+		SET
+			movie_id = $2
+		WHERE
+			movie_id = $1;`, o.table)
+
+	_, err = tx.ExecContext(ctx, updateQuery, oldMovieID, newMovieID)
+
+	return err
+}
@@ -0,0 +1,313 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/lib/pq"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// RandomFilters narrows down the movies which GetRandom() picks from. The title,
+// genres and country work like the filters of GetAll(), and the ranges are
+// inclusive. Zero values don't filter.
+type RandomFilters struct {
+	Title      string
+	Genres     []string
+	Country    string
+	MinYear    int32
+	MaxYear    int32
+	MinRuntime int32
+	MaxRuntime int32
+}
+
+func ValidateRandomFilters(v *validator.Validator, f RandomFilters) {
+	v.Check(f.MinYear >= 0, "min-year", "must not be negative")
+	v.Check(f.MaxYear >= 0, "max-year", "must not be negative")
+	v.Check(f.MaxYear == 0 || f.MinYear <= f.MaxYear, "max-year", "must not be less than min-year")
+	v.Check(f.MinRuntime >= 0, "min-runtime", "must not be negative")
+	v.Check(f.MaxRuntime >= 0, "max-runtime", "must not be negative")
+	v.Check(f.MaxRuntime == 0 || f.MinRuntime <= f.MaxRuntime, "max-runtime", "must not be less than min-runtime")
+}
+
+// When no more than randomScanLimit movies match the filters, GetRandom() reads
+// all of their ids and picks among them. Otherwise it probes for them by id.
+const randomScanLimit = 1000
+
+// The number of rounds of probes GetRandom() makes before it settles for fewer
+// movies than were asked for.
+const randomProbeRounds = 4
+
+// GetRandom picks up to count distinct movies at random from those matching the
+// filters. The same seed picks the same movies for as long as the movies don't
+// change.
+//
+// Neither counting nor numbering every matching movie scales to a large catalogue,
+// so the matching movies are found in one of two ways, both of which only walk the
+// primary key index:
+//
+//   - If no more than randomScanLimit movies match, all of their ids are read and
+//     the picks are drawn from them with samplePositions(), so every matching
+//     movie is equally likely to be picked.
+//   - Otherwise random ids between the lowest and highest id are drawn in Go, and
+//     each is replaced with the first matching movie at or after it, wrapping
+//     around to the start. This is a single index lookup per probe, but a movie
+//     which follows a long run of deleted or unmatched ids is picked more often
+//     than one which doesn't. Duplicates are probed again, up to
+//     randomProbeRounds times.
+//
+// All the queries run in one snapshot, so they agree with each other.
+func (m MovieModel) GetRandom(ctx context.Context, filters RandomFilters, count int, seed uint64) ([]*Movie, error) {
+	conditions := movieFilterConditions + `
+		AND
+			($4::integer = 0 OR movies.year >= $4::integer)
+		AND
+			($5::integer = 0 OR movies.year <= $5::integer)
+		AND
+			($6::integer = 0 OR movies.runtime >= $6::integer)
+		AND
+			($7::integer = 0 OR movies.runtime <= $7::integer)`
+
+	args := []any{
+		filters.Title,
+		pq.Array(filters.Genres),
+		filters.Country,
+		filters.MinYear,
+		filters.MaxYear,
+		filters.MinRuntime,
+		filters.MaxRuntime,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	rng := rand.New(rand.NewPCG(seed, seed))
+
+	scanQuery := fmt.Sprintf(`
+		SELECT
+			movies.id
+		FROM
+			movies
+		WHERE %v
+		ORDER BY
+			movies.id
+		LIMIT $8;`, conditions)
+
+	ids, err := queryIDs(ctx, tx, scanQuery, append(args, randomScanLimit+1)...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var picked []int64
+
+	if len(ids) <= randomScanLimit {
+		for _, position := range samplePositions(rng, len(ids), count) {
+			picked = append(picked, ids[position])
+		}
+	} else {
+		var minID, maxID int64
+
+		err = tx.QueryRowContext(ctx, `SELECT MIN(id), MAX(id) FROM movies;`).Scan(&minID, &maxID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Each probe is replaced with the first matching movie at or after it, or
+		// failing that the first matching movie, and the movies are returned in the
+		// order of the probes.
+		probeQuery := fmt.Sprintf(`
+			SELECT
+				picked.id
+			FROM
+				unnest($8::bigint[]) WITH ORDINALITY AS probe(start, n)
+			CROSS JOIN LATERAL (
+				(SELECT movies.id FROM movies WHERE movies.id >= probe.start AND %[1]v ORDER BY movies.id LIMIT 1)
+				UNION ALL
+				(SELECT movies.id FROM movies WHERE movies.id < probe.start AND %[1]v ORDER BY movies.id LIMIT 1)
+				LIMIT 1
+			) AS picked
+			ORDER BY
+				probe.n;`, conditions)
+
+		picked, err = probeRandom(rng, minID, maxID, count, func(starts []int64) ([]int64, error) {
+			return queryIDs(ctx, tx, probeQuery, append(args, pq.Array(starts))...)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(picked) == 0 {
+		return []*Movie{}, nil
+	}
+
+	// Read the picked movies, in the order they were picked.
+	query := `
+		SELECT
+			id,
+			created_at,
+			title,
+			year,
+			runtime,
+			movie_genres(id) AS genres,
+			version,
+			rating,
+			rating_count,
+			poster_urls,
+			backdrop_urls
+		FROM
+			movies
+		WHERE
+			id = ANY($1::bigint[])
+		ORDER BY
+			array_position($1::bigint[], id);`
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(picked))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.Poster,
+			&movie.Backdrop,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// queryIDs runs a query which returns a single column of ids.
+func queryIDs(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// probeRandom picks up to count distinct ids by drawing random ids from minID to
+// maxID and passing them to probe, which returns the matching id each of them
+// lands on, in order. Twice as many probes as there are ids left to pick are drawn
+// in each round, to make up for duplicates.
+func probeRandom(rng *rand.Rand, minID, maxID int64, count int, probe func(starts []int64) ([]int64, error)) ([]int64, error) {
+	picked := make([]int64, 0, count)
+	seen := make(map[int64]bool, count)
+
+	for range randomProbeRounds {
+		if len(picked) == count {
+			break
+		}
+
+		starts := make([]int64, 2*(count-len(picked)))
+
+		for i := range starts {
+			starts[i] = minID + rng.Int64N(maxID-minID+1)
+		}
+
+		ids, err := probe(starts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range ids {
+			if !seen[id] && len(picked) < count {
+				seen[id] = true
+				picked = append(picked, id)
+			}
+		}
+	}
+
+	return picked, nil
+}
+
+// samplePositions draws k distinct positions from 0 to n-1, or all of them in a
+// random order if k >= n. It uses Robert Floyd's algorithm, which only needs k
+// draws and k values of memory however large n is.
+func samplePositions(rng *rand.Rand, n int, k int) []int64 {
+	k = min(k, n)
+
+	positions := make([]int64, 0, k)
+	picked := make(map[int64]bool, k)
+
+	for j := n - k; j < n; j++ {
+		position := rng.Int64N(int64(j) + 1)
+
+		if picked[position] {
+			position = int64(j)
+		}
+
+		picked[position] = true
+		positions = append(positions, position)
+	}
+
+	// Floyd's algorithm picks a uniformly random set, but later draws favour the
+	// higher positions, so the order is shuffled too.
+	rng.Shuffle(len(positions), func(i, j int) {
+		positions[i], positions[j] = positions[j], positions[i]
+	})
+
+	return positions
+}
@@ -0,0 +1,136 @@
+package data
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestSamplePositions(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		k    int
+		want int
+	}{
+		{"fewer than n", 100, 5, 5},
+		{"all of n", 5, 5, 5},
+		{"more than n", 3, 5, 3},
+		{"empty", 0, 5, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positions := samplePositions(rand.New(rand.NewPCG(1, 1)), tt.n, tt.k)
+
+			if len(positions) != tt.want {
+				t.Fatalf("got %d positions; want %d", len(positions), tt.want)
+			}
+
+			seen := map[int64]bool{}
+
+			for _, p := range positions {
+				if p < 0 || p >= int64(tt.n) || seen[p] {
+					t.Errorf("got position %d in %v; want distinct positions below %d", p, positions, tt.n)
+				}
+
+				seen[p] = true
+			}
+
+			again := samplePositions(rand.New(rand.NewPCG(1, 1)), tt.n, tt.k)
+
+			if !slices.Equal(positions, again) {
+				t.Errorf("got %v and then %v with the same seed", positions, again)
+			}
+		})
+	}
+}
+
+func TestProbeRandom(t *testing.T) {
+	// Every probe lands on the next multiple of 10, wrapping around after 100.
+	probe := func(starts []int64) ([]int64, error) {
+		ids := make([]int64, len(starts))
+
+		for i, start := range starts {
+			ids[i] = (start+9)/10*10%100 + 10
+		}
+
+		return ids, nil
+	}
+
+	ids, err := probeRandom(rand.New(rand.NewPCG(1, 1)), 1, 100, 5, probe)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 5 {
+		t.Fatalf("got %d ids; want 5", len(ids))
+	}
+
+	seen := map[int64]bool{}
+
+	for _, id := range ids {
+		if id%10 != 0 || seen[id] {
+			t.Errorf("got %v; want distinct multiples of 10", ids)
+		}
+
+		seen[id] = true
+	}
+
+	// Asking for more ids than there are to land on settles for the ones found.
+	probe = func(starts []int64) ([]int64, error) {
+		return slices.Repeat([]int64{42}, len(starts)), nil
+	}
+
+	ids, err = probeRandom(rand.New(rand.NewPCG(1, 1)), 1, 100, 5, probe)
+
+	if err != nil || !slices.Equal(ids, []int64{42}) {
+		t.Errorf("got %v, %v; want [42], nil", ids, err)
+	}
+}
+
+func TestMemoryMoviesGetRandom(t *testing.T) {
+	ctx := context.Background()
+	movies := NewMemoryMovies(nil)
+
+	// More movies than randomScanLimit, so that they are probed for.
+	for i := range randomScanLimit + 500 {
+		movie := &Movie{Title: "Movie", Year: int32(1900 + i%100), Runtime: 90}
+
+		if err := movies.Insert(ctx, movie, Editor{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filters := RandomFilters{MinYear: 1950}
+
+	picked, err := movies.GetRandom(ctx, filters, 10, 7)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(picked) != 10 {
+		t.Fatalf("got %d movies; want 10", len(picked))
+	}
+
+	seen := map[int64]bool{}
+
+	for _, movie := range picked {
+		if movie.Year < 1950 || seen[movie.ID] {
+			t.Errorf("got movie %d from %d; want distinct movies from 1950 on", movie.ID, movie.Year)
+		}
+
+		seen[movie.ID] = true
+	}
+
+	again, _ := movies.GetRandom(ctx, filters, 10, 7)
+
+	for i := range picked {
+		if again[i].ID != picked[i].ID {
+			t.Fatalf("got different movies with the same seed")
+		}
+	}
+}
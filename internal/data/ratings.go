@@ -0,0 +1,106 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// A Rating is the score from 1 to 10 a user has given a movie. Each user has at
+// most one rating per movie.
+type Rating struct {
+	UserID    int64     `json:"-"`
+	MovieID   int64     `json:"movie_id"`
+	Rating    int32     `json:"rating"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ValidateRating(v *validator.Validator, rating *Rating) {
+	v.Check(rating.Rating >= 1, "rating", "must be at least 1")
+	v.Check(rating.Rating <= 10, "rating", "must be no more than 10")
+}
+
+// Define a RatingModel struct type which wraps a sql.DB connection pool. The
+// average and count on each movie are kept up to date by a trigger on the ratings
+// table, so they change whenever a rating is set or deleted.
+type RatingModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Set creates or replaces the rating a user has given a movie. ErrRecordNotFound is
+// returned if the movie doesn't exist.
+func (m RatingModel) Set(ctx context.Context, rating *Rating) error {
+	const query = `
+		INSERT INTO ratings (
+			user_id,
+			movie_id,
+			rating)
+		VALUES (
+			$1,
+			$2,
+			$3
+		)
+		ON CONFLICT (user_id, movie_id) DO UPDATE
+		SET
+			rating = EXCLUDED.rating,
+			updated_at = NOW()
+		RETURNING
+			updated_at;`
+
+	args := []any{rating.UserID, rating.MovieID, rating.Rating}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&rating.UpdatedAt)
+
+	if err != nil {
+		var pqError *pq.Error
+
+		if errors.As(err, &pqError) && pqError.Constraint == "ratings_movie_id_fkey" {
+			return ErrRecordNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes the rating a user has given a movie. ErrRecordNotFound is returned
+// if the user hasn't rated the movie.
+func (m RatingModel) Delete(ctx context.Context, userID int64, movieID int64) error {
+	const query = `
+		DELETE FROM
+			ratings
+		WHERE
+			user_id = $1
+		AND
+			movie_id = $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, movieID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// Define a custom ErrDuplicateRelation error for when two movies which are already
+// related are related again.
+var ErrDuplicateRelation = errors.New("duplicate relation")
+
+// Define constants for the types of relation between two movies. A relation reads
+// as "the related movie is the <type> of the movie", so if B is the sequel of A
+// then A is the prequel of B.
+const (
+	RelationSequel   = "sequel"
+	RelationPrequel  = "prequel"
+	RelationRemake   = "remake"
+	RelationOriginal = "original"
+	RelationSpinOff  = "spin_off"
+	RelationParent   = "parent"
+)
+
+// relationInverses maps each relation type to the type of the same relation seen
+// from the other movie.
+var relationInverses = map[string]string{
+	RelationSequel:   RelationPrequel,
+	RelationPrequel:  RelationSequel,
+	RelationRemake:   RelationOriginal,
+	RelationOriginal: RelationRemake,
+	RelationSpinOff:  RelationParent,
+	RelationParent:   RelationSpinOff,
+}
+
+// A RelatedMovie is a movie along with how it relates to another movie.
+type RelatedMovie struct {
+	Relation string `json:"relation"`
+	Movie    *Movie `json:"movie"`
+}
+
+// A Relation links two movies. It is stored from both sides, so only one direction
+// needs to be created.
+type Relation struct {
+	MovieID        int64  `json:"movie_id"`
+	RelatedMovieID int64  `json:"related_movie_id"`
+	Type           string `json:"type"`
+}
+
+func ValidateRelation(v *validator.Validator, relation *Relation) {
+	_, ok := relationInverses[relation.Type]
+
+	v.Check(relation.RelatedMovieID > 0, "related_movie_id", "must be provided")
+	v.Check(relation.RelatedMovieID != relation.MovieID, "related_movie_id", "must not be the movie itself")
+	v.Check(ok, "type", "must be sequel, prequel, remake, original, spin_off or parent")
+}
+
+// Define a RelationModel struct type which wraps a sql.DB connection pool.
+type RelationModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Insert relates two movies, storing the relation from both sides. ErrRecordNotFound
+// is returned if either movie doesn't exist, and ErrDuplicateRelation if the movies
+// are already related.
+func (m RelationModel) Insert(ctx context.Context, relation *Relation) error {
+	const query = `
+		INSERT INTO movie_relations (
+			movie_id,
+			related_movie_id,
+			type)
+		VALUES
+			($1, $2, $3),
+			($2, $1, $4);`
+
+	args := []any{relation.MovieID, relation.RelatedMovieID, relation.Type, relationInverses[relation.Type]}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		var pqError *pq.Error
+
+		if errors.As(err, &pqError) {
+			switch pqError.Constraint {
+			case "movie_relations_movie_id_fkey", "movie_relations_related_movie_id_fkey":
+				return ErrRecordNotFound
+			case "movie_relations_pkey":
+				return ErrDuplicateRelation
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes the relation between two movies from both sides.
+// ErrRecordNotFound is returned if the movies aren't related.
+func (m RelationModel) Delete(ctx context.Context, movieID int64, relatedMovieID int64) error {
+	const query = `
+		DELETE FROM
+			movie_relations
+		WHERE
+			(movie_id = $1 AND related_movie_id = $2)
+		OR
+			(movie_id = $2 AND related_movie_id = $1);`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, relatedMovieID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetRelated returns the movies related to a movie, grouped by relation type and
+// then in release order.
+func (m RelationModel) GetRelated(ctx context.Context, movieID int64) ([]*RelatedMovie, error) {
+	const query = `
+		SELECT
+			movie_relations.type,
+			movies.id,
+			movies.created_at,
+			movies.title,
+			movies.year,
+			movies.runtime,
+			movie_genres(movies.id) AS genres,
+			movies.version,
+			movies.rating,
+			movies.rating_count,
+			movies.poster_urls,
+			movies.backdrop_urls
+		FROM
+			movie_relations
+		INNER JOIN
+			movies ON movies.id = movie_relations.related_movie_id
+		WHERE
+			movie_relations.movie_id = $1
+		ORDER BY
+			movie_relations.type ASC,
+			movies.year ASC,
+			movies.id ASC;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	related := []*RelatedMovie{}
+
+	for rows.Next() {
+		var relation string
+		var movie Movie
+
+		err := rows.Scan(
+			&relation,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.Poster,
+			&movie.Backdrop,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		related = append(related, &RelatedMovie{Relation: relation, Movie: &movie})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return related, nil
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// CountryRX matches an uppercase ISO 3166-1 alpha-2 country code, like "GB".
+var CountryRX = regexp.MustCompile("^[A-Z]{2}$")
+
+// The layout of release dates, which are dates without a time of day.
+const releaseDateLayout = "2006-01-02"
+
+// A Release is the date a movie was released in one country, along with the age
+// certification it was given there.
+type Release struct {
+	MovieID       int64  `json:"-"`
+	Country       string `json:"country"`
+	Date          string `json:"date"`
+	Certification string `json:"certification,omitzero"`
+}
+
+func ValidateRelease(v *validator.Validator, release *Release) {
+	_, err := time.Parse(releaseDateLayout, release.Date)
+
+	v.Check(validator.Matches(release.Country, CountryRX), "country", "must be a two letter country code like GB")
+	v.Check(release.Date != "", "date", "must be provided")
+	v.Check(release.Date == "" || err == nil, "date", "must be a date like 2006-01-02")
+	v.Check(len(release.Certification) <= 20, "certification", "must not be more than 20 bytes long")
+}
+
+// Define a ReleaseModel struct type which wraps a sql.DB connection pool.
+type ReleaseModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Upsert creates or replaces the release of a movie in a country.
+// ErrRecordNotFound is returned if the movie doesn't exist.
+func (m ReleaseModel) Upsert(ctx context.Context, release *Release) error {
+	const query = `
+		INSERT INTO movie_releases (
+			movie_id,
+			country,
+			date,
+			certification)
+		VALUES (
+			$1,
+			$2,
+			$3::date,
+			$4
+		)
+		ON CONFLICT (movie_id, country) DO UPDATE
+		SET
+			date = EXCLUDED.date,
+			certification = EXCLUDED.certification;`
+
+	args := []any{release.MovieID, release.Country, release.Date, release.Certification}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		var pqError *pq.Error
+
+		if errors.As(err, &pqError) && pqError.Constraint == "movie_releases_movie_id_fkey" {
+			return ErrRecordNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// GetAllForMovie returns every release of a movie, earliest first.
+func (m ReleaseModel) GetAllForMovie(ctx context.Context, movieID int64) ([]*Release, error) {
+	const query = `
+		SELECT
+			movie_id,
+			country,
+			date::text,
+			certification
+		FROM
+			movie_releases
+		WHERE
+			movie_id = $1
+		ORDER BY
+			date ASC,
+			country ASC;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	releases := []*Release{}
+
+	for rows.Next() {
+		var release Release
+
+		err := rows.Scan(&release.MovieID, &release.Country, &release.Date, &release.Certification)
+
+		if err != nil {
+			return nil, err
+		}
+
+		releases = append(releases, &release)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
+
+// Delete removes the release of a movie in a country. ErrRecordNotFound is
+// returned if there is no such release.
+func (m ReleaseModel) Delete(ctx context.Context, movieID int64, country string) error {
+	const query = `
+		DELETE FROM
+			movie_releases
+		WHERE
+			movie_id = $1
+		AND
+			country = $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, country)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
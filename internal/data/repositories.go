@@ -0,0 +1,45 @@
+package data
+
+import "context"
+
+// MovieRepository is the set of operations on movies which the handlers use.
+// MovieModel implements it on top of PostgreSQL, and MemoryMovies keeps the movies
+// in memory so that the handlers can be tested without a database.
+type MovieRepository interface {
+	Insert(ctx context.Context, movie *Movie, editor Editor) error
+	InsertBatch(ctx context.Context, movies []*Movie, editor Editor) error
+	Import(ctx context.Context, movies []*Movie, editor Editor) error
+	Get(ctx context.Context, id int64) (*Movie, error)
+	Exists(ctx context.Context, id int64) (bool, error)
+	GetLocalized(ctx context.Context, id int64, locales []string) (*Movie, error)
+	GetAll(ctx context.Context, title string, genres []string, country string, locales []string, filters Filters) ([]*Movie, *Metadata, error)
+	Export(ctx context.Context, title string, genres []string, country string, filters Filters, fn func(*Movie) error) error
+	Update(ctx context.Context, movie *Movie, editor Editor) error
+	Delete(ctx context.Context, id int64, editor Editor) ([]Image, error)
+	SetImage(ctx context.Context, id int64, kind string, image Image) (Image, error)
+	GetSimilar(ctx context.Context, movieID int64, weights SimilarityWeights, limit int) ([]*SimilarMovie, error)
+	GetRandom(ctx context.Context, filters RandomFilters, count int, seed uint64) ([]*Movie, error)
+	GetStats(ctx context.Context, title string, genres []string, country string) (*MovieStats, error)
+	GetDuplicates(ctx context.Context, runtimeTolerance int32, filters Filters) ([]*DuplicateCandidate, *Metadata, error)
+	Merge(ctx context.Context, sourceID int64, targetID int64, editor Editor) ([]Image, error)
+	GetRedirect(ctx context.Context, id int64) (int64, error)
+}
+
+// GenreRepository is the set of operations on genres which the handlers use. The
+// movie handlers validate genres against it, so it has an in-memory implementation
+// too, MemoryGenres.
+type GenreRepository interface {
+	Insert(ctx context.Context, genre *Genre) error
+	GetAll(ctx context.Context) (GenreSet, error)
+	Get(ctx context.Context, id int64) (*Genre, error)
+	Update(ctx context.Context, genre *Genre) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// Check at compile time that the models implement the interfaces.
+var (
+	_ MovieRepository = MovieModel{}
+	_ MovieRepository = (*MemoryMovies)(nil)
+	_ GenreRepository = GenreModel{}
+	_ GenreRepository = (*MemoryGenres)(nil)
+)
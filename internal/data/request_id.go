@@ -0,0 +1,40 @@
+package data
+
+import (
+	"context"
+	"regexp"
+)
+
+// RequestIDRX matches the request IDs which we accept from clients. They are
+// copied into response headers, log entries and SQL comments, so only a short run
+// of characters which need no escaping in any of them is allowed.
+var RequestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type contextKey string
+
+const requestIDContextKey = contextKey("request_id")
+
+// ContextWithRequestID returns a copy of ctx carrying the ID of the request which
+// the queries run with it are made for.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or an empty string if
+// there isn't one.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
+
+// tagQuery appends the request ID carried by ctx to the query as a comment. The ID
+// is checked again here, since it could contain "*/" otherwise.
+func tagQuery(ctx context.Context, query string) string {
+	requestID := RequestIDFromContext(ctx)
+
+	if !RequestIDRX.MatchString(requestID) {
+		return query
+	}
+
+	return query + "\n/* request_id=" + requestID + " */"
+}
@@ -0,0 +1,299 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// Define a custom ErrDuplicateReview error for when a user reviews a movie they
+// have already reviewed.
+var ErrDuplicateReview = errors.New("duplicate review")
+
+// Define constants for the moderation states of a review. New and edited reviews
+// are pending until a moderator approves or rejects them, and only approved
+// reviews are shown to other users.
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+type Review struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Status    string    `json:"status"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Title != "", "title", "must be provided")
+	v.Check(len(review.Title) <= 200, "title", "must not be more than 200 bytes long")
+	v.Check(review.Body != "", "body", "must be provided")
+	v.Check(len(review.Body) <= 10_000, "body", "must not be more than 10000 bytes long")
+	ValidateReviewStatus(v, review.Status)
+}
+
+func ValidateReviewStatus(v *validator.Validator, status string) {
+	v.Check(validator.PermittedValue(status, ReviewPending, ReviewApproved, ReviewRejected), "status", "must be pending, approved or rejected")
+}
+
+// Define a ReviewModel struct type which wraps a sql.DB connection pool.
+type ReviewModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Insert adds a new review. ErrRecordNotFound is returned if the movie doesn't
+// exist, and ErrDuplicateReview if the user has already reviewed the movie.
+func (m ReviewModel) Insert(ctx context.Context, review *Review) error {
+	const query = `
+		INSERT INTO reviews (
+			movie_id,
+			user_id,
+			title,
+			body,
+			status)
+		VALUES (
+			$1,
+			$2,
+			$3,
+			$4,
+			$5
+		)
+		RETURNING
+			id,
+			created_at,
+			updated_at,
+			version;`
+
+	args := []any{review.MovieID, review.UserID, review.Title, review.Body, review.Status}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+
+	if err != nil {
+		var pqError *pq.Error
+
+		if errors.As(err, &pqError) {
+			switch pqError.Constraint {
+			case "reviews_movie_id_fkey":
+				return ErrRecordNotFound
+			case "reviews_movie_id_user_id_key":
+				return ErrDuplicateReview
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (m ReviewModel) Get(ctx context.Context, id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	const query = `
+		SELECT
+			id,
+			created_at,
+			updated_at,
+			movie_id,
+			user_id,
+			title,
+			body,
+			status,
+			version
+		FROM
+			reviews
+		WHERE
+			id = $1;`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&review.ID,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.MovieID,
+		&review.UserID,
+		&review.Title,
+		&review.Body,
+		&review.Status,
+		&review.Version,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// GetAll returns a page of the reviews with the given status. A movieID of 0
+// matches reviews of every movie. The reviews written by authorID are included
+// whatever their status, so that users can see their own pending reviews; pass 0
+// to only match on status.
+func (m ReviewModel) GetAll(ctx context.Context, movieID int64, status string, authorID int64, filters Filters) ([]*Review, *Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*) OVER(),
+			id,
+			created_at,
+			updated_at,
+			movie_id,
+			user_id,
+			title,
+			body,
+			status,
+			version
+		FROM
+			reviews
+		WHERE
+			($1 = 0 OR movie_id = $1)
+		AND
+			(status = $2 OR user_id = $3)
+		ORDER BY %v %v, id ASC
+		LIMIT $4
+		OFFSET $5;`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{movieID, status, authorID, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	reviews := []*Review{}
+
+	totalRecords := 0
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.MovieID,
+			&review.UserID,
+			&review.Title,
+			&review.Body,
+			&review.Status,
+			&review.Version,
+		)
+
+		if err != nil {
+			return nil, &Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, &metadata, nil
+}
+
+// Update saves the title, body and status of a review using the same optimistic
+// locking as movies.
+func (m ReviewModel) Update(ctx context.Context, review *Review) error {
+	const query = `
+		UPDATE
+			reviews
+		SET
+			title = $1,
+			body = $2,
+			status = $3,
+			updated_at = NOW(),
+			version = version + 1
+		WHERE
+			id = $4
+		AND
+			version = $5
+		RETURNING
+			updated_at,
+			version;`
+
+	args := []any{review.Title, review.Body, review.Status, review.ID, review.Version}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.Version)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (m ReviewModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	const query = `
+		DELETE FROM
+			reviews
+		WHERE
+			id = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
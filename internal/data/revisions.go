@@ -0,0 +1,362 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Define constants for the operations recorded in the movie_revisions table.
+const (
+	RevisionInsert = "insert"
+	RevisionUpdate = "update"
+	RevisionDelete = "delete"
+)
+
+// Editor identifies who made a change to a movie. A zero UserID means the change
+// was made by an anonymous user.
+type Editor struct {
+	UserID    int64
+	RequestID string
+}
+
+// A Revision is a snapshot of a single insert, update or delete of a movie. The
+// old and new values are the full movie before and after the change, so either
+// can be nil (there is nothing before an insert or after a delete).
+type Revision struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	MovieID   int64     `json:"movie_id"`
+	Version   int32     `json:"version"`
+	Operation string    `json:"operation"`
+	OldValues *Movie    `json:"old_values"`
+	NewValues *Movie    `json:"new_values"`
+	UserID    *int64    `json:"user_id"`
+	RequestID string    `json:"request_id,omitzero"`
+}
+
+// insertRevision records a revision as part of an existing transaction so that
+// the revision is only persisted if the movie write itself is committed.
+func insertRevision(ctx context.Context, tx *sql.Tx, revision *Revision) error {
+	const query = `
+		INSERT INTO movie_revisions (
+			movie_id,
+			version,
+			operation,
+			old_values,
+			new_values,
+			user_id,
+			request_id)
+		VALUES (
+			$1,
+			$2,
+			$3,
+			$4,
+			$5,
+			$6,
+			$7
+		)
+		RETURNING
+			id,
+			created_at;`
+
+	oldValues, err := marshalRevisionValues(revision.OldValues)
+
+	if err != nil {
+		return err
+	}
+
+	newValues, err := marshalRevisionValues(revision.NewValues)
+
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		revision.MovieID,
+		revision.Version,
+		revision.Operation,
+		oldValues,
+		newValues,
+		revision.UserID,
+		revision.RequestID,
+	}
+
+	return tx.QueryRowContext(ctx, query, args...).Scan(&revision.ID, &revision.CreatedAt)
+}
+
+// insertRevisions records several revisions with a single multi-row INSERT as
+// part of an existing transaction.
+func insertRevisions(ctx context.Context, tx *sql.Tx, revisions []*Revision) error {
+	if len(revisions) == 0 {
+		return nil
+	}
+
+	rows := make([]string, len(revisions))
+	args := make([]any, 0, len(revisions)*7)
+
+	for i, revision := range revisions {
+		oldValues, err := marshalRevisionValues(revision.OldValues)
+
+		if err != nil {
+			return err
+		}
+
+		newValues, err := marshalRevisionValues(revision.NewValues)
+
+		if err != nil {
+			return err
+		}
+
+		rows[i] = placeholders(i*7+1, 7)
+		args = append(
+			args,
+			revision.MovieID,
+			revision.Version,
+			revision.Operation,
+			oldValues,
+			newValues,
+			revision.UserID,
+			revision.RequestID,
+		)
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO movie_revisions (
+			movie_id,
+			version,
+			operation,
+			old_values,
+			new_values,
+			user_id,
+			request_id)
+		VALUES
+			%v;`, strings.Join(rows, ",\n\t\t\t"))
+
+	_, err := tx.ExecContext(ctx, query, args...)
+
+	return err
+}
+
+// newRevision builds a Revision for the given operation. The movie ID and version
+// are taken from the new values, or from the old values for a delete.
+func newRevision(operation string, oldValues *Movie, newValues *Movie, editor Editor) *Revision {
+	revision := &Revision{
+		Operation: operation,
+		OldValues: oldValues,
+		NewValues: newValues,
+		RequestID: editor.RequestID,
+	}
+
+	current := newValues
+
+	if current == nil {
+		current = oldValues
+	}
+
+	revision.MovieID = current.ID
+	revision.Version = current.Version
+
+	if editor.UserID != 0 {
+		revision.UserID = &editor.UserID
+	}
+
+	return revision
+}
+
+// The jsonb columns are sent as strings since pq would otherwise encode a []byte
+// as bytea. A nil movie is stored as NULL.
+func marshalRevisionValues(movie *Movie) (any, error) {
+	if movie == nil {
+		return nil, nil
+	}
+
+	// Ratings change with every rating a user gives, rather than with the version
+	// of the movie, so they are left out of the recorded values.
+	values := *movie
+	values.Rating = 0
+	values.RatingCount = 0
+
+	js, err := json.Marshal(values)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return string(js), nil
+}
+
+func unmarshalRevisionValues(js []byte) (*Movie, error) {
+	if js == nil {
+		return nil, nil
+	}
+
+	var movie Movie
+
+	err := json.Unmarshal(js, &movie)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &movie, nil
+}
+
+// Define a RevisionModel struct type which wraps a sql.DB connection pool.
+type RevisionModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// GetAllForMovie returns a page of revisions for a movie. Revisions outlive the
+// movie itself, so the history of a deleted movie can still be retrieved.
+func (m RevisionModel) GetAllForMovie(ctx context.Context, movieID int64, filters Filters) ([]*Revision, *Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*) OVER(),
+			id,
+			created_at,
+			movie_id,
+			version,
+			operation,
+			old_values,
+			new_values,
+			user_id,
+			request_id
+		FROM
+			movie_revisions
+		WHERE
+			movie_id = $1
+		ORDER BY %v %v, id %v
+		LIMIT $2
+		OFFSET $3;`, filters.sortColumn(), filters.sortDirection(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+
+	if err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	totalRecords := 0
+
+	for rows.Next() {
+		var revision Revision
+		var oldValues, newValues []byte
+
+		err := rows.Scan(
+			&totalRecords,
+			&revision.ID,
+			&revision.CreatedAt,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Operation,
+			&oldValues,
+			&newValues,
+			&revision.UserID,
+			&revision.RequestID,
+		)
+
+		if err != nil {
+			return nil, &Metadata{}, err
+		}
+
+		revision.OldValues, err = unmarshalRevisionValues(oldValues)
+
+		if err != nil {
+			return nil, &Metadata{}, err
+		}
+
+		revision.NewValues, err = unmarshalRevisionValues(newValues)
+
+		if err != nil {
+			return nil, &Metadata{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, &metadata, nil
+}
+
+// GetForVersion returns the revision which produced the given version of a movie.
+// Deletes are ignored since they don't produce a new state to revert to.
+func (m RevisionModel) GetForVersion(ctx context.Context, movieID int64, version int32) (*Revision, error) {
+	const query = `
+		SELECT
+			id,
+			created_at,
+			movie_id,
+			version,
+			operation,
+			old_values,
+			new_values,
+			user_id,
+			request_id
+		FROM
+			movie_revisions
+		WHERE
+			movie_id = $1
+		AND
+			version = $2
+		AND
+			operation <> 'delete'
+		ORDER BY id DESC
+		LIMIT 1;`
+
+	var revision Revision
+	var oldValues, newValues []byte
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version).Scan(
+		&revision.ID,
+		&revision.CreatedAt,
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Operation,
+		&oldValues,
+		&newValues,
+		&revision.UserID,
+		&revision.RequestID,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	revision.OldValues, err = unmarshalRevisionValues(oldValues)
+
+	if err != nil {
+		return nil, err
+	}
+
+	revision.NewValues, err = unmarshalRevisionValues(newValues)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
@@ -29,6 +29,12 @@ func (r Runtime) MarshalJSON() ([]byte, error) {
 	return []byte(quotedJSONValue), nil
 }
 
+// String returns the runtime in the "<runtime> mins" format used in the JSON
+// representation, for formats like CSV where the value isn't quoted.
+func (r Runtime) String() string {
+	return fmt.Sprintf("%d mins", r)
+}
+
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 	// We expect the incoming json value will be a string in the format
 	// "<runtime> mins" and the first thing we need to do is remvoe the surrounding
@@ -40,13 +46,30 @@ func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 		return ErrInvalidRuntimeFormat
 	}
 
+	runtime, err := ParseRuntime(unquotedJSONValue)
+
+	if err != nil {
+		return err
+	}
+
+	// Assign the parsed runtime to the receiver. Note that we use the * operator to
+	// dereference the receiver (which is a pointer to a Runtime type) in order to
+	// set the underlying value to the pointer.
+	*r = runtime
+
+	return nil
+}
+
+// ParseRuntime parses an unquoted runtime string in the format "<runtime> mins",
+// as found in the JSON representation or a CSV file.
+func ParseRuntime(s string) (Runtime, error) {
 	// Split the string to isolate teh part containing the number
-	parts := strings.Split(unquotedJSONValue, " ")
+	parts := strings.Split(s, " ")
 
 	// Sanity check the parts of the string to make sure it was in the expected format.
 	// If it isn't we return the ErrInvalidRuntimeFormat error again.
 	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+		return 0, ErrInvalidRuntimeFormat
 	}
 
 	// Otherwise parse the string containing the number into an int32. Again, if this
@@ -54,13 +77,9 @@ func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 	i, err := strconv.ParseInt(parts[0], 10, 32)
 
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return 0, ErrInvalidRuntimeFormat
 	}
 
-	// Convert the int32 to a Runtime type and assign this to the receiver. Note that
-	// we use the * operator to dereference the receiver (which is a pointer to a Runtime type)
-	// in order to set the underlying value to the pointer.
-	*r = Runtime(i)
-
-	return nil
+	// Convert the int32 to a Runtime type.
+	return Runtime(i), nil
 }
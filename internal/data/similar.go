@@ -0,0 +1,334 @@
+package data
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SimilarityWeights sets how much the genres, year and runtime of two movies count
+// towards how similar they are. Only the ratios between the weights matter.
+type SimilarityWeights struct {
+	Genres  float64
+	Year    float64
+	Runtime float64
+}
+
+// A SimilarMovie is a movie along with how similar it is to another movie, from 0
+// (nothing in common) to 1.
+type SimilarMovie struct {
+	Score float64 `json:"score"`
+	Movie *Movie  `json:"movie"`
+}
+
+// A similarityEntry holds what a movie is scored on. The genres are sorted ids.
+type similarityEntry struct {
+	id      int64
+	year    int32
+	runtime int32
+	genres  []int64
+}
+
+// A similarityScore is the score of one movie against the target movie.
+type similarityScore struct {
+	id    int64
+	score float64
+}
+
+// score returns how similar the entry is to the target, as the weighted average of:
+//
+//   - the Jaccard index of the two sets of genres (shared genres divided by all
+//     genres of either movie),
+//   - the year proximity 1 / (1 + years apart / 10), which halves ten years apart,
+//   - the runtime similarity 1 - runtime difference / the longer runtime.
+//
+// It returns false if the movies don't share a genre, since they aren't scored.
+func (e similarityEntry) score(target similarityEntry, weights SimilarityWeights) (float64, bool) {
+	shared := 0
+
+	for i, j := 0, 0; i < len(e.genres) && j < len(target.genres); {
+		switch {
+		case e.genres[i] < target.genres[j]:
+			i++
+		case e.genres[i] > target.genres[j]:
+			j++
+		default:
+			shared++
+			i++
+			j++
+		}
+	}
+
+	if shared == 0 {
+		return 0, false
+	}
+
+	genreScore := float64(shared) / float64(len(e.genres)+len(target.genres)-shared)
+	yearScore := 1 / (1 + math.Abs(float64(e.year-target.year))/10)
+	runtimeScore := 1 - math.Abs(float64(e.runtime-target.runtime))/float64(max(e.runtime, target.runtime, 1))
+
+	return (weights.Genres*genreScore + weights.Year*yearScore + weights.Runtime*runtimeScore) / (weights.Genres + weights.Year + weights.Runtime), true
+}
+
+// topSimilar scores every entry which shares a genre with the target and returns
+// the best limit of them, best match first, with ties broken by id. Only the best
+// limit scores are kept while scoring, so the whole catalogue is never sorted.
+func topSimilar(target similarityEntry, entries []similarityEntry, weights SimilarityWeights, limit int) []similarityScore {
+	top := &similarityHeap{}
+
+	for _, entry := range entries {
+		if entry.id == target.id {
+			continue
+		}
+
+		score, ok := entry.score(target, weights)
+
+		if !ok {
+			continue
+		}
+
+		s := similarityScore{id: entry.id, score: score}
+
+		if top.Len() < limit {
+			heap.Push(top, s)
+		} else if top.Len() > 0 && worse((*top)[0], s) {
+			(*top)[0] = s
+			heap.Fix(top, 0)
+		}
+	}
+
+	scores := []similarityScore(*top)
+
+	slices.SortFunc(scores, func(a, b similarityScore) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), cmp.Compare(a.id, b.id))
+	})
+
+	return scores
+}
+
+// worse reports whether a ranks below b.
+func worse(a, b similarityScore) bool {
+	return a.score < b.score || (a.score == b.score && a.id > b.id)
+}
+
+// A similarityHeap is a min-heap with the worst of the kept scores at the root.
+type similarityHeap []similarityScore
+
+func (h similarityHeap) Len() int           { return len(h) }
+func (h similarityHeap) Less(i, j int) bool { return worse(h[i], h[j]) }
+func (h similarityHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *similarityHeap) Push(x any)        { *h = append(*h, x.(similarityScore)) }
+
+func (h *similarityHeap) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
+// A SimilarityIndex holds the year, runtime and genre ids of every movie in memory,
+// so that scoring similar movies is a single pass over a slice rather than a query
+// which joins every candidate against its genres. The index is a snapshot, so it
+// must be rebuilt periodically with Rebuild(); movies added since are missing from
+// the results until then, and no movie has similar movies until it is first built.
+// It is safe for concurrent use.
+type SimilarityIndex struct {
+	DB      *sql.DB
+	Timeout time.Duration
+
+	mu      sync.RWMutex
+	entries []similarityEntry
+}
+
+// Rebuild reads every movie and replaces the contents of the index.
+func (s *SimilarityIndex) Rebuild(ctx context.Context) error {
+	const query = `
+		SELECT
+			movies.id,
+			movies.year,
+			movies.runtime,
+			COALESCE(ARRAY_AGG(movies_genres.genre_id ORDER BY movies_genres.genre_id) FILTER (WHERE movies_genres.genre_id IS NOT NULL), '{}')
+		FROM
+			movies
+		LEFT JOIN
+			movies_genres ON movies_genres.movie_id = movies.id
+		GROUP BY
+			movies.id
+		ORDER BY
+			movies.id;`
+
+	// Reading the whole catalogue takes longer than a regular query.
+	ctx, cancel := context.WithTimeout(ctx, max(s.Timeout, time.Minute))
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	entries := []similarityEntry{}
+
+	for rows.Next() {
+		var entry similarityEntry
+
+		err := rows.Scan(&entry.id, &entry.year, &entry.runtime, pq.Array(&entry.genres))
+
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.entries = entries
+	s.mu.Unlock()
+
+	return nil
+}
+
+// top returns the best scores against the target from the index.
+func (s *SimilarityIndex) top(target similarityEntry, weights SimilarityWeights, limit int) []similarityScore {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return topSimilar(target, s.entries, weights, limit)
+}
+
+// GetSimilar returns the movies most similar to a movie, best match first, scored
+// as described by similarityEntry.score(). The movie itself is read from the
+// database, so that a movie added since the index was last rebuilt can still be
+// matched, and the candidates are scored in memory with the SimilarityIndex.
+// Only movies which share at least one genre are scored, so a movie without any
+// genres has no similar movies.
+func (m MovieModel) GetSimilar(ctx context.Context, movieID int64, weights SimilarityWeights, limit int) ([]*SimilarMovie, error) {
+	const targetQuery = `
+		SELECT
+			movies.id,
+			movies.year,
+			movies.runtime,
+			COALESCE(ARRAY_AGG(movies_genres.genre_id ORDER BY movies_genres.genre_id) FILTER (WHERE movies_genres.genre_id IS NOT NULL), '{}')
+		FROM
+			movies
+		LEFT JOIN
+			movies_genres ON movies_genres.movie_id = movies.id
+		WHERE
+			movies.id = $1
+		GROUP BY
+			movies.id;`
+
+	const moviesQuery = `
+		SELECT
+			id,
+			created_at,
+			title,
+			year,
+			runtime,
+			movie_genres(id) AS genres,
+			version,
+			rating,
+			rating_count,
+			poster_urls,
+			backdrop_urls,
+			movie_external_ids(id) AS external_ids
+		FROM
+			movies
+		WHERE
+			id = ANY($1);`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	similar := []*SimilarMovie{}
+
+	var target similarityEntry
+
+	err := m.DB.QueryRowContext(ctx, targetQuery, movieID).Scan(&target.id, &target.year, &target.runtime, pq.Array(&target.genres))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return similar, nil
+		}
+
+		return nil, err
+	}
+
+	scores := m.Similarity.top(target, weights, limit)
+
+	if len(scores) == 0 {
+		return similar, nil
+	}
+
+	ids := make([]int64, len(scores))
+
+	for i, s := range scores {
+		ids[i] = s.id
+	}
+
+	rows, err := m.DB.QueryContext(ctx, moviesQuery, pq.Array(ids))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	movies := map[int64]*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.Poster,
+			&movie.Backdrop,
+			&movie.ExternalIDs,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		movies[movie.ID] = &movie
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Movies deleted since the index was rebuilt are skipped.
+	for _, s := range scores {
+		if movie, ok := movies[s.id]; ok {
+			similar = append(similar, &SimilarMovie{Score: s.score, Movie: movie})
+		}
+	}
+
+	return similar, nil
+}
@@ -0,0 +1,65 @@
+package data
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimilarityEntryScore(t *testing.T) {
+	weights := SimilarityWeights{Genres: 1, Year: 1, Runtime: 1}
+	target := similarityEntry{id: 1, year: 2000, runtime: 100, genres: []int64{1, 2}}
+
+	tests := []struct {
+		name   string
+		entry  similarityEntry
+		want   float64
+		scored bool
+	}{
+		{"identical", similarityEntry{id: 2, year: 2000, runtime: 100, genres: []int64{1, 2}}, 1, true},
+		{"no shared genres", similarityEntry{id: 2, year: 2000, runtime: 100, genres: []int64{3}}, 0, false},
+		{"no genres", similarityEntry{id: 2, year: 2000, runtime: 100}, 0, false},
+		// Jaccard 1/3, ten years apart 0.5, runtime 1 - 100/200 = 0.5.
+		{"partial", similarityEntry{id: 2, year: 2010, runtime: 200, genres: []int64{2, 3}}, (1.0/3 + 0.5 + 0.5) / 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, scored := tt.entry.score(target, weights)
+
+			if scored != tt.scored || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, %v; want %v, %v", got, scored, tt.want, tt.scored)
+			}
+		})
+	}
+}
+
+func TestTopSimilar(t *testing.T) {
+	weights := SimilarityWeights{Genres: 1}
+	target := similarityEntry{id: 1, genres: []int64{1, 2}}
+
+	entries := []similarityEntry{
+		target,
+		{id: 2, genres: []int64{1}},
+		{id: 3, genres: []int64{1, 2}},
+		{id: 4, genres: []int64{3}},
+		{id: 5, genres: []int64{2}},
+		{id: 6, genres: []int64{1, 2, 3}},
+	}
+
+	got := topSimilar(target, entries, weights, 3)
+	want := []int64{3, 6, 2}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d scores; want %d", len(got), len(want))
+	}
+
+	for i, s := range got {
+		if s.id != want[i] {
+			t.Errorf("got id %d at %d; want %d", s.id, i, want[i])
+		}
+	}
+
+	if got := topSimilar(target, entries, weights, 0); len(got) != 0 {
+		t.Errorf("got %d scores with a limit of 0; want 0", len(got))
+	}
+}
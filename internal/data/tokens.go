@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"time"
+
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// Define constants for the token scopes. For now we only have authentication
+// tokens but this gives us room to add others (like password resets) later.
+const (
+	ScopeAuthentication = "authentication"
+)
+
+// The Token struct holds the data for an individual token. Only the plaintext
+// and expiry are sent to the client, the hash is what we store in the database.
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+}
+
+func generateToken(userID int64, ttl time.Duration, scope string) *Token {
+	token := &Token{
+		// rand.Text() returns a cryptographically random base32 string with at
+		// least 128 bits of entropy.
+		Plaintext: rand.Text(),
+		UserID:    userID,
+		Expiry:    time.Now().Add(ttl),
+		Scope:     scope,
+	}
+
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token
+}
+
+func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
+	v.Check(tokenPlaintext != "", "token", "must be provided")
+	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+
+	_, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(tokenPlaintext)
+	v.Check(err == nil, "token", "must be base32 encoded")
+}
+
+// Define a TokenModel struct type which wraps a sql.DB connection pool.
+type TokenModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// New is a shortcut which creates a new token and inserts it into the tokens table.
+func (m TokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token := generateToken(userID, ttl, scope)
+
+	err := m.Insert(ctx, token)
+
+	return token, err
+}
+
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
+	const query = `
+		INSERT INTO tokens (
+			hash,
+			user_id,
+			expiry,
+			scope)
+		VALUES (
+			$1,
+			$2,
+			$3,
+			$4
+		);`
+
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+
+	return err
+}
@@ -0,0 +1,164 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// LocaleRX matches a lowercase BCP 47 language tag made up of a 2 or 3 letter
+// language and optional subtags, like "fr", "pt-br" or "zh-hant-tw".
+var LocaleRX = regexp.MustCompile("^[a-z]{2,3}(?:-[a-z0-9]{2,8})*$")
+
+// NormalizeLocale converts a language tag like "pt_BR" into the lowercase form
+// "pt-br" which translations are stored under.
+func NormalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// A Translation is the title and overview of a movie in one locale.
+type Translation struct {
+	MovieID  int64  `json:"-"`
+	Locale   string `json:"locale"`
+	Title    string `json:"title"`
+	Overview string `json:"overview,omitzero"`
+}
+
+func ValidateTranslation(v *validator.Validator, translation *Translation) {
+	v.Check(validator.Matches(translation.Locale, LocaleRX), "locale", "must be a language tag like fr or pt-BR")
+	v.Check(translation.Title != "", "title", "must be provided")
+	v.Check(len(translation.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(len(translation.Overview) <= 10_000, "overview", "must not be more than 10000 bytes long")
+}
+
+// Define a TranslationModel struct type which wraps a sql.DB connection pool.
+type TranslationModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Upsert creates or replaces the translation of a movie into a locale.
+// ErrRecordNotFound is returned if the movie doesn't exist.
+func (m TranslationModel) Upsert(ctx context.Context, translation *Translation) error {
+	const query = `
+		INSERT INTO movie_translations (
+			movie_id,
+			locale,
+			title,
+			overview)
+		VALUES (
+			$1,
+			$2,
+			$3,
+			$4
+		)
+		ON CONFLICT (movie_id, locale) DO UPDATE
+		SET
+			title = EXCLUDED.title,
+			overview = EXCLUDED.overview;`
+
+	args := []any{translation.MovieID, translation.Locale, translation.Title, translation.Overview}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		var pqError *pq.Error
+
+		if errors.As(err, &pqError) && pqError.Constraint == "movie_translations_movie_id_fkey" {
+			return ErrRecordNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// GetAllForMovie returns every translation of a movie ordered by locale.
+func (m TranslationModel) GetAllForMovie(ctx context.Context, movieID int64) ([]*Translation, error) {
+	const query = `
+		SELECT
+			movie_id,
+			locale,
+			title,
+			overview
+		FROM
+			movie_translations
+		WHERE
+			movie_id = $1
+		ORDER BY
+			locale ASC;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	translations := []*Translation{}
+
+	for rows.Next() {
+		var translation Translation
+
+		err := rows.Scan(&translation.MovieID, &translation.Locale, &translation.Title, &translation.Overview)
+
+		if err != nil {
+			return nil, err
+		}
+
+		translations = append(translations, &translation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return translations, nil
+}
+
+// Delete removes the translation of a movie into a locale. ErrRecordNotFound is
+// returned if there is no such translation.
+func (m TranslationModel) Delete(ctx context.Context, movieID int64, locale string) error {
+	const query = `
+		DELETE FROM
+			movie_translations
+		WHERE
+			movie_id = $1
+		AND
+			locale = $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, locale)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
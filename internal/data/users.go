@@ -0,0 +1,255 @@
+package data
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// Define a custom ErrDuplicateEmail error for when a user signs up with an email
+// address that is already in use.
+var ErrDuplicateEmail = errors.New("duplicate email")
+
+// The number of PBKDF2 iterations used when hashing new passwords. The value is
+// stored alongside each hash so it can be raised later without breaking existing
+// passwords.
+const passwordIterations = 600_000
+
+// AnonymousUser represents a request which did not carry an authentication token.
+var AnonymousUser = &User{}
+
+type User struct {
+	ID       int64    `json:"id"`
+	Email    string   `json:"email"`
+	Password password `json:"-"`
+}
+
+// IsAnonymous returns true if the user is the AnonymousUser instance.
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+// The password type holds the plaintext password (only available when the
+// password has just been set) and the encoded hash that is stored in the database.
+type password struct {
+	plaintext *string
+	hash      string
+}
+
+// Set hashes the plaintext password with PBKDF2-SHA256 and a random salt. The
+// hash is encoded as "pbkdf2-sha256$<iterations>$<salt>$<key>".
+func (p *password) Set(plaintext string) error {
+	salt := make([]byte, 16)
+
+	_, err := rand.Read(salt)
+
+	if err != nil {
+		return err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, plaintext, salt, passwordIterations, 32)
+
+	if err != nil {
+		return err
+	}
+
+	p.plaintext = &plaintext
+	p.hash = fmt.Sprintf(
+		"pbkdf2-sha256$%d$%s$%s",
+		passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return nil
+}
+
+// Matches checks whether the plaintext password matches the stored hash.
+func (p *password) Matches(plaintext string) (bool, error) {
+	parts := strings.Split(p.hash, "$")
+
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false, errors.New("invalid password hash format")
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+
+	if err != nil {
+		return false, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return false, err
+	}
+
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+
+	if err != nil {
+		return false, err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, plaintext, salt, iterations, len(expected))
+
+	if err != nil {
+		return false, err
+	}
+
+	// Use a constant time comparison so the time taken doesn't leak how much of
+	// the hash matched.
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
+
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "must be provided")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+}
+
+func ValidatePasswordPlaintext(v *validator.Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
+	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+}
+
+func ValidateUser(v *validator.Validator, user *User) {
+	ValidateEmail(v, user.Email)
+
+	if user.Password.plaintext != nil {
+		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+	}
+
+	// If the password hash is ever empty, this is a logic error in our codebase
+	// rather than a problem with the client's input, so we panic.
+	if user.Password.hash == "" {
+		panic("missing password hash for user")
+	}
+}
+
+// Define a UserModel struct type which wraps a sql.DB connection pool.
+type UserModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+func (m UserModel) Insert(ctx context.Context, user *User) error {
+	const query = `
+		INSERT INTO users (
+			email,
+			password)
+		VALUES (
+			$1,
+			$2
+		)
+		RETURNING
+			id;`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, user.Email, user.Password.hash).Scan(&user.ID)
+
+	if err != nil {
+		// A violation of the users_email_key constraint means the email address
+		// has already been registered.
+		var pqError *pq.Error
+
+		if errors.As(err, &pqError) && pqError.Constraint == "users_email_key" {
+			return ErrDuplicateEmail
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	const query = `
+		SELECT
+			id,
+			email,
+			password
+		FROM
+			users
+		WHERE
+			email = $1;`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Password.hash,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetForToken returns the user that owns a non-expired token with the given
+// scope and plaintext value.
+func (m UserModel) GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	const query = `
+		SELECT
+			users.id,
+			users.email,
+			users.password
+		FROM
+			users
+		INNER JOIN
+			tokens ON users.id = tokens.user_id
+		WHERE
+			tokens.hash = $1
+		AND
+			tokens.scope = $2
+		AND
+			tokens.expiry > $3;`
+
+	args := []any{tokenHash[:], tokenScope, time.Now()}
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Password.hash,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &user, nil
+}
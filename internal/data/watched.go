@@ -0,0 +1,215 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wendelfabianchinsamy/lets-go-further/internal/validator"
+)
+
+// A WatchEvent records that a user watched a movie. Movies can be watched more
+// than once, so a user can have several events for the same movie.
+type WatchEvent struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	MovieID   int64     `json:"movie_id"`
+	WatchedAt time.Time `json:"watched_at"`
+}
+
+// WatchStats summarises the watch history of a user. Every event is counted, so
+// the total runtime includes rewatches.
+type WatchStats struct {
+	TotalWatched    int           `json:"total_watched"`
+	UniqueMovies    int           `json:"unique_movies"`
+	TotalRuntime    Runtime       `json:"total_runtime"`
+	FavouriteGenres []*GenreCount `json:"favourite_genres"`
+	WatchedByYear   []*YearCount  `json:"watched_by_year"`
+}
+
+type GenreCount struct {
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type YearCount struct {
+	Year  int32 `json:"year"`
+	Count int   `json:"count"`
+}
+
+// The number of genres included in the favourite genres of WatchStats.
+const favouriteGenresLimit = 5
+
+func ValidateWatchEvent(v *validator.Validator, event *WatchEvent) {
+	v.Check(event.MovieID > 0, "movie_id", "must be provided")
+	v.Check(!event.WatchedAt.IsZero(), "watched_at", "must be provided")
+	v.Check(event.WatchedAt.Before(time.Now().Add(time.Minute)), "watched_at", "must not be in the future")
+}
+
+// Define a WatchHistoryModel struct type which wraps a sql.DB connection pool.
+type WatchHistoryModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Insert records a watch event. ErrRecordNotFound is returned if the movie doesn't
+// exist.
+func (m WatchHistoryModel) Insert(ctx context.Context, event *WatchEvent) error {
+	const query = `
+		INSERT INTO watch_history (
+			user_id,
+			movie_id,
+			watched_at)
+		VALUES (
+			$1,
+			$2,
+			$3
+		)
+		RETURNING
+			id;`
+
+	args := []any{event.UserID, event.MovieID, event.WatchedAt}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID)
+
+	if err != nil {
+		var pqError *pq.Error
+
+		if errors.As(err, &pqError) && pqError.Constraint == "watch_history_movie_id_fkey" {
+			return ErrRecordNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// GetStats computes the watch statistics of a user. The queries run in a single
+// read-only transaction, so that they all see the same history.
+func (m WatchHistoryModel) GetStats(ctx context.Context, userID int64) (*WatchStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	const totalsQuery = `
+		SELECT
+			COUNT(*),
+			COUNT(DISTINCT watch_history.movie_id),
+			COALESCE(SUM(movies.runtime), 0)
+		FROM
+			watch_history
+		INNER JOIN
+			movies ON movies.id = watch_history.movie_id
+		WHERE
+			watch_history.user_id = $1;`
+
+	stats := WatchStats{
+		FavouriteGenres: []*GenreCount{},
+		WatchedByYear:   []*YearCount{},
+	}
+
+	err = tx.QueryRowContext(ctx, totalsQuery, userID).Scan(&stats.TotalWatched, &stats.UniqueMovies, &stats.TotalRuntime)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Each watch event counts once towards every genre of the movie.
+	const genresQuery = `
+		SELECT
+			genres.slug,
+			genres.name,
+			COUNT(*) AS count
+		FROM
+			watch_history
+		INNER JOIN
+			movies_genres ON movies_genres.movie_id = watch_history.movie_id
+		INNER JOIN
+			genres ON genres.id = movies_genres.genre_id
+		WHERE
+			watch_history.user_id = $1
+		GROUP BY
+			genres.id
+		ORDER BY
+			count DESC,
+			genres.name ASC
+		LIMIT $2;`
+
+	rows, err := tx.QueryContext(ctx, genresQuery, userID, favouriteGenresLimit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var genre GenreCount
+
+		err := rows.Scan(&genre.Slug, &genre.Name, &genre.Count)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stats.FavouriteGenres = append(stats.FavouriteGenres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Years are taken in UTC, regardless of the time zone of the database session.
+	const yearsQuery = `
+		SELECT
+			EXTRACT(YEAR FROM watched_at AT TIME ZONE 'UTC')::integer AS year,
+			COUNT(*)
+		FROM
+			watch_history
+		WHERE
+			user_id = $1
+		GROUP BY
+			year
+		ORDER BY
+			year ASC;`
+
+	rows, err = tx.QueryContext(ctx, yearsQuery, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var year YearCount
+
+		err := rows.Scan(&year.Year, &year.Count)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stats.WatchedByYear = append(stats.WatchedByYear, &year)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
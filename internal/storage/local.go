@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// Local is a Storage which keeps files in a directory on the local filesystem. All
+// access goes through an os.Root, so a key can never refer to a file outside the
+// directory.
+type Local struct {
+	root    *os.Root
+	baseURL string
+}
+
+// NewLocal returns a Local storage for the directory dir, creating it if needed.
+// The URL of each file is its key appended to baseURL.
+func NewLocal(dir string, baseURL string) (*Local, error) {
+	err := os.MkdirAll(dir, 0o755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := os.OpenRoot(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{root: root, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Put writes the file to a temporary name first and then renames it, so that a
+// partially written file is never visible under key.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader) error {
+	err := l.root.MkdirAll(path.Dir(key), 0o755)
+
+	if err != nil {
+		return err
+	}
+
+	tmp := key + ".tmp-" + rand.Text()
+
+	f, err := l.root.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		l.root.Remove(tmp)
+		return err
+	}
+
+	return l.root.Rename(tmp, key)
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	err := l.root.Remove(key)
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.baseURL + "/" + key
+}
+
+// Open returns the file stored under key, so that it can be served to clients.
+// ErrNotFound is returned if there is no such file, or key refers to a directory.
+func (l *Local) Open(key string) (*os.File, error) {
+	// Keys come from the URL, so reject anything like "../x" up front rather than
+	// relying on the os.Root error.
+	if !fs.ValidPath(key) {
+		return nil, ErrNotFound
+	}
+
+	f, err := l.root.Open(key)
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if info.IsDir() {
+		f.Close()
+		return nil, ErrNotFound
+	}
+
+	return f, nil
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Define a custom ErrNotFound error for when a stored object doesn't exist.
+var ErrNotFound = errors.New("object not found")
+
+// A Storage stores uploaded files, like movie posters, under a key such as
+// "movies/1/poster/abc/small". Keys use forward slashes whatever the backend.
+type Storage interface {
+	// Put stores the contents of r under key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// Delete removes the object stored under key. Deleting a key which doesn't
+	// exist isn't an error.
+	Delete(ctx context.Context, key string) error
+
+	// URL returns the URL clients can fetch the object stored under key from.
+	URL(key string) string
+}
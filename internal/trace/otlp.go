@@ -0,0 +1,265 @@
+package trace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// The number of spans which can wait to be written. Spans exported while the
+// queue is full are dropped, so that a slow writer never holds up requests.
+const exportQueueSize = 2048
+
+// The most spans written as one line.
+const maxExportBatch = 256
+
+// JSONExporter writes spans to w in the OTLP/JSON format, as one
+// ExportTraceServiceRequest object per line. This is the format of the
+// OpenTelemetry collector's file exporter, so the output can be replayed into a
+// collector or read by anything which understands OTLP.
+//
+// Spans are queued and written by a background goroutine, so Export never waits
+// for w. The spans which are queued together are written as one line. Shutdown()
+// must be called before the program exits, to write the spans still queued.
+type JSONExporter struct {
+	w        *bufio.Writer
+	resource []otlpKeyValue
+	// ErrorLog is called when spans can't be written or are dropped. It may be
+	// nil, and must be set before the first span is exported.
+	ErrorLog func(error)
+
+	mu      sync.RWMutex
+	closed  bool
+	spans   chan otlpSpan
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// NewJSONExporter returns an exporter which writes to w, describing the spans as
+// coming from the named service, and starts its background writer.
+func NewJSONExporter(w io.Writer, serviceName string, serviceVersion string) *JSONExporter {
+	e := &JSONExporter{
+		w: bufio.NewWriter(w),
+		resource: []otlpKeyValue{
+			otlpAttribute(Attribute{"service.name", serviceName}),
+			otlpAttribute(Attribute{"service.version", serviceVersion}),
+		},
+		spans: make(chan otlpSpan, exportQueueSize),
+		done:  make(chan struct{}),
+	}
+
+	go e.run()
+
+	return e
+}
+
+// The otlp types below mirror the parts of the OTLP protobuf messages which we use,
+// with the field names of their JSON mapping. IDs are hex strings, and 64 bit
+// integers are decimal strings.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// The status codes are 0 for unset, 1 for ok and 2 for error.
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func otlpAttribute(attr Attribute) otlpKeyValue {
+	var value map[string]any
+
+	switch v := attr.Value.(type) {
+	case string:
+		value = map[string]any{"stringValue": v}
+	case bool:
+		value = map[string]any{"boolValue": v}
+	case int64:
+		value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		value = map[string]any{"doubleValue": v}
+	default:
+		value = map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+
+	return otlpKeyValue{Key: attr.Key, Value: value}
+}
+
+// Export queues the span to be written. The span is dropped if the queue is full
+// or the exporter has been shut down.
+func (e *JSONExporter) Export(span *Span) {
+	s := newOTLPSpan(span)
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.closed {
+		return
+	}
+
+	select {
+	case e.spans <- s:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Shutdown stops the exporter accepting spans and waits for the ones already
+// queued to be written, or for ctx to be done. It doesn't close the underlying
+// writer. Calling it more than once is safe.
+func (e *JSONExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+
+	if !e.closed {
+		e.closed = true
+		close(e.spans)
+	}
+
+	e.mu.Unlock()
+
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run writes the queued spans until the queue is closed. Whatever else is queued
+// when a span arrives is written along with it, and the output is flushed whenever
+// the queue is empty.
+func (e *JSONExporter) run() {
+	defer close(e.done)
+
+	for s := range e.spans {
+		batch := []otlpSpan{s}
+
+	fill:
+		for len(batch) < maxExportBatch {
+			select {
+			case s, ok := <-e.spans:
+				if !ok {
+					break fill
+				}
+
+				batch = append(batch, s)
+			default:
+				break fill
+			}
+		}
+
+		err := e.write(batch)
+
+		if err == nil && len(e.spans) == 0 {
+			err = e.w.Flush()
+		}
+
+		e.logError(err)
+		e.logDropped()
+	}
+
+	e.logError(e.w.Flush())
+	e.logDropped()
+}
+
+// write writes the spans as a single line of JSON.
+func (e *JSONExporter) write(spans []otlpSpan) error {
+	request := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: e.resource},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/wendelfabianchinsamy/lets-go-further"},
+				Spans: spans,
+			}},
+		}},
+	}
+
+	js, err := json.Marshal(request)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(append(js, '\n'))
+
+	return err
+}
+
+func (e *JSONExporter) logError(err error) {
+	if err != nil && e.ErrorLog != nil {
+		e.ErrorLog(err)
+	}
+}
+
+// logDropped reports the spans dropped since it was last called.
+func (e *JSONExporter) logDropped() {
+	if n := e.dropped.Swap(0); n > 0 {
+		e.logError(fmt.Errorf("trace: dropped %d spans because the export queue was full", n))
+	}
+}
+
+// newOTLPSpan converts a finished span to its OTLP form.
+func newOTLPSpan(span *Span) otlpSpan {
+	s := otlpSpan{
+		TraceID:           fmt.Sprintf("%x", span.SpanContext.TraceID),
+		SpanID:            fmt.Sprintf("%x", span.SpanContext.SpanID),
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+	}
+
+	if span.ParentID != [8]byte{} {
+		s.ParentSpanID = fmt.Sprintf("%x", span.ParentID)
+	}
+
+	for _, attr := range span.Attributes {
+		s.Attributes = append(s.Attributes, otlpAttribute(attr))
+	}
+
+	if span.Err != nil {
+		s.Status = otlpStatus{Code: 2, Message: span.Err.Error()}
+	}
+
+	return s
+}
@@ -0,0 +1,192 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJSONExporterEncoding(t *testing.T) {
+	var buf bytes.Buffer
+
+	exporter := NewJSONExporter(&buf, "test-service", "1.0.0")
+
+	start := time.Unix(1700000000, 500)
+
+	exporter.Export(&Span{
+		Name:        "GET /v1/movies/:id",
+		Kind:        SpanKindServer,
+		SpanContext: SpanContext{TraceID: [16]byte{0x4b, 15: 0x36}, SpanID: [8]byte{0x01, 7: 0xb7}, Sampled: true},
+		ParentID:    [8]byte{0xaa, 7: 0xbb},
+		StartTime:   start,
+		EndTime:     start.Add(time.Second),
+		Attributes: []Attribute{
+			{"http.route", "/v1/movies/:id"},
+			{"http.response.status_code", int64(500)},
+			{"sampled", true},
+			{"ratio", 0.5},
+		},
+		Err: errors.New("Internal Server Error"),
+	})
+
+	err := exporter.Shutdown(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var request struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpKeyValue `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []map[string]any `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+
+	err = json.Unmarshal(buf.Bytes(), &request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource := request.ResourceSpans[0].Resource.Attributes
+
+	if resource[0].Key != "service.name" || resource[0].Value["stringValue"] != "test-service" {
+		t.Errorf("got resource %v; want the service name", resource)
+	}
+
+	span := request.ResourceSpans[0].ScopeSpans[0].Spans[0]
+
+	want := map[string]any{
+		"traceId":           "4b000000000000000000000000000036",
+		"spanId":            "01000000000000b7",
+		"parentSpanId":      "aa000000000000bb",
+		"name":              "GET /v1/movies/:id",
+		"kind":              float64(SpanKindServer),
+		"startTimeUnixNano": "1700000000000000500",
+		"endTimeUnixNano":   "1700000001000000500",
+	}
+
+	for key, value := range want {
+		if span[key] != value {
+			t.Errorf("got %s %v; want %v", key, span[key], value)
+		}
+	}
+
+	attributes, _ := json.Marshal(span["attributes"])
+	wantAttributes := `[{"key":"http.route","value":{"stringValue":"/v1/movies/:id"}},` +
+		`{"key":"http.response.status_code","value":{"intValue":"500"}},` +
+		`{"key":"sampled","value":{"boolValue":true}},` +
+		`{"key":"ratio","value":{"doubleValue":0.5}}]`
+
+	if string(attributes) != wantAttributes {
+		t.Errorf("got attributes %s; want %s", attributes, wantAttributes)
+	}
+
+	status, _ := json.Marshal(span["status"])
+
+	if string(status) != `{"code":2,"message":"Internal Server Error"}` {
+		t.Errorf("got status %s; want an error status", status)
+	}
+}
+
+func TestJSONExporterOmitsRootParent(t *testing.T) {
+	var buf bytes.Buffer
+
+	exporter := NewJSONExporter(&buf, "test-service", "1.0.0")
+	exporter.Export(&Span{Name: "root", SpanContext: SpanContext{TraceID: [16]byte{1}, SpanID: [8]byte{1}}})
+	exporter.Shutdown(context.Background())
+
+	if strings.Contains(buf.String(), "parentSpanId") {
+		t.Errorf("got %s; want no parentSpanId for a root span", buf.String())
+	}
+
+	if strings.Contains(buf.String(), `"status":{"code"`) {
+		t.Errorf("got %s; want an unset status", buf.String())
+	}
+}
+
+func TestJSONExporterDropsWhenFull(t *testing.T) {
+	w := &blockingWriter{entered: make(chan struct{}), release: make(chan struct{})}
+
+	var mu sync.Mutex
+	var errs []error
+
+	exporter := NewJSONExporter(w, "test-service", "1.0.0")
+	exporter.ErrorLog = func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+
+	span := &Span{Name: "span", SpanContext: SpanContext{TraceID: [16]byte{1}, SpanID: [8]byte{1}}}
+
+	// The first span is flushed straight away, which blocks the writer, so the
+	// queue then fills up.
+	exporter.Export(span)
+	<-w.entered
+
+	for range exportQueueSize + 5 {
+		exporter.Export(span)
+	}
+
+	close(w.release)
+
+	err := exporter.Shutdown(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Spans exported after shutdown are ignored.
+	exporter.Export(span)
+
+	if got := strings.Count(w.buf.String(), `"name":"span"`); got != exportQueueSize+1 {
+		t.Errorf("got %d spans written; want %d", got, exportQueueSize+1)
+	}
+
+	if len(errs) != 1 || errs[0].Error() != "trace: dropped 5 spans because the export queue was full" {
+		t.Errorf("got errors %v; want one reporting 5 dropped spans", errs)
+	}
+}
+
+func TestJSONExporterShutdownTimeout(t *testing.T) {
+	w := &blockingWriter{entered: make(chan struct{}), release: make(chan struct{})}
+	defer close(w.release)
+
+	exporter := NewJSONExporter(w, "test-service", "1.0.0")
+	exporter.Export(&Span{Name: "span"})
+	<-w.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := exporter.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// A blockingWriter blocks its first write until release is closed.
+type blockingWriter struct {
+	buf     bytes.Buffer
+	once    sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.entered)
+		<-w.release
+	})
+
+	return w.buf.Write(p)
+}
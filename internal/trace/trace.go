@@ -0,0 +1,278 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A SpanKind describes the relationship between a span and the work around it.
+// The values are the ones used by OTLP.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// A SpanContext identifies a span within a trace. It is what is passed between
+// services in the W3C traceparent header.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether both the trace and span IDs are set. The W3C spec
+// doesn't allow IDs which are all zeroes.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats the span context as a W3C traceparent header value, like
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%x-%x-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value. The second return value
+// is false if the value is malformed, in which case the caller should start a new
+// trace. Versions other than 00 are parsed as version 00, as the spec asks, and
+// any fields after the flags are ignored.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+
+	// Version ff is forbidden, and version 00 has exactly four fields.
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+
+	var version, flags [1]byte
+
+	for _, field := range []struct {
+		dst []byte
+		src string
+	}{
+		{version[:], parts[0]},
+		{sc.TraceID[:], parts[1]},
+		{sc.SpanID[:], parts[2]},
+		{flags[:], parts[3]},
+	} {
+		// Only lowercase hex is allowed.
+		if strings.ToLower(field.src) != field.src {
+			return SpanContext{}, false
+		}
+
+		_, err := hex.Decode(field.dst, []byte(field.src))
+
+		if err != nil {
+			return SpanContext{}, false
+		}
+	}
+
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+
+	sc.Sampled = flags[0]&0x01 == 1
+
+	return sc, true
+}
+
+// An Attribute is a key and value describing a span, like "http.route" and
+// "/v1/movies/:id". Values are strings, bools, int64s or float64s.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// A Span records a single operation, like handling a request or running a query.
+// All of its methods can be called on a nil *Span, which does nothing, so code
+// doesn't need to check whether tracing is enabled.
+type Span struct {
+	tracer *Tracer
+
+	Name        string
+	Kind        SpanKind
+	SpanContext SpanContext
+	ParentID    [8]byte
+	StartTime   time.Time
+	EndTime     time.Time
+	Attributes  []Attribute
+	// Err is the error the operation failed with, if any.
+	Err error
+
+	mu    sync.Mutex
+	ended bool
+}
+
+// SetName renames the span, for when a better name is only known once the
+// operation has started.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Name = name
+}
+
+// SetAttributes adds attributes to the span. Ints are stored as int64s.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, attr := range attrs {
+		if v, ok := attr.Value.(int); ok {
+			attr.Value = int64(v)
+		}
+
+		s.Attributes = append(s.Attributes, attr)
+	}
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Err = err
+}
+
+// End ends the span and passes it to the exporter if it was sampled. Calling it
+// more than once has no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	if s.SpanContext.Sampled {
+		s.tracer.exporter.Export(s)
+	}
+}
+
+// An Exporter sends finished spans somewhere they can be looked at, like a file or
+// an OpenTelemetry collector. Export is called from many goroutines at once, so it
+// shouldn't block. Exporters which buffer spans can also implement Shutdown, which
+// Tracer.Shutdown() calls.
+type Exporter interface {
+	Export(span *Span)
+}
+
+// A Tracer starts spans and hands them to its exporter when they finish. A nil
+// *Tracer is valid and starts no spans.
+type Tracer struct {
+	exporter Exporter
+}
+
+// New returns a Tracer which exports spans with exporter.
+func New(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Shutdown waits for the spans which have ended to be exported, if the exporter
+// has a Shutdown(context.Context) error method, or for ctx to be done. Spans which
+// end afterwards may be lost, so it should be called once the server has stopped
+// handling requests.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	if s, ok := t.exporter.(interface{ Shutdown(context.Context) error }); ok {
+		return s.Shutdown(ctx)
+	}
+
+	return nil
+}
+
+type contextKey string
+
+const (
+	spanContextKey   = contextKey("span")
+	remoteContextKey = contextKey("remote")
+)
+
+// Start starts a span which is a child of the span in ctx, or of the remote span
+// added by ContextWithRemote(). If there is neither a new trace is started, which
+// is always sampled. It returns a copy of ctx carrying the new span, which the
+// caller must End().
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer:    t,
+		Name:      name,
+		Kind:      kind,
+		StartTime: time.Now(),
+	}
+
+	// The IDs are read with rand.Read, which never returns an error on the
+	// platforms we support.
+	if parent, ok := ctx.Value(spanContextKey).(*Span); ok {
+		span.SpanContext = parent.SpanContext
+		span.ParentID = parent.SpanContext.SpanID
+	} else if remote, ok := ctx.Value(remoteContextKey).(SpanContext); ok {
+		span.SpanContext = remote
+		span.ParentID = remote.SpanID
+	} else {
+		rand.Read(span.SpanContext.TraceID[:])
+		span.SpanContext.Sampled = true
+	}
+
+	rand.Read(span.SpanContext.SpanID[:])
+
+	return context.WithValue(ctx, spanContextKey, span), span
+}
+
+// ContextWithRemote returns a copy of ctx carrying a span context received from
+// another service, so that spans started with it continue that trace.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteContextKey, sc)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil if there isn't one.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey).(*Span)
+	return span
+}
@@ -0,0 +1,100 @@
+package trace
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+
+	tests := []struct {
+		name        string
+		value       string
+		wantOK      bool
+		wantSampled bool
+	}{
+		{"sampled", "00-" + traceID + "-" + spanID + "-01", true, true},
+		{"not sampled", "00-" + traceID + "-" + spanID + "-00", true, false},
+		{"surrounding space", " 00-" + traceID + "-" + spanID + "-01 ", true, true},
+		{"other flags", "00-" + traceID + "-" + spanID + "-03", true, true},
+		{"future version with extra fields", "cc-" + traceID + "-" + spanID + "-01-extra", true, true},
+		{"version 00 with extra fields", "00-" + traceID + "-" + spanID + "-01-extra", false, false},
+		{"version ff", "ff-" + traceID + "-" + spanID + "-01", false, false},
+		{"uppercase", "00-" + "4BF92F3577B34DA6A3CE929D0E0E4736" + "-" + spanID + "-01", false, false},
+		{"not hex", "00-" + "zbf92f3577b34da6a3ce929d0e0e4736" + "-" + spanID + "-01", false, false},
+		{"zero trace ID", "00-00000000000000000000000000000000-" + spanID + "-01", false, false},
+		{"zero span ID", "00-" + traceID + "-0000000000000000-01", false, false},
+		{"short trace ID", "00-" + traceID[1:] + "-" + spanID + "-01", false, false},
+		{"missing flags", "00-" + traceID + "-" + spanID, false, false},
+		{"empty", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.value)
+
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %v; want %v", ok, tt.wantOK)
+			}
+
+			if !ok {
+				if sc != (SpanContext{}) {
+					t.Errorf("got %+v; want the zero SpanContext", sc)
+				}
+
+				return
+			}
+
+			if sc.Sampled != tt.wantSampled {
+				t.Errorf("got sampled %v; want %v", sc.Sampled, tt.wantSampled)
+			}
+
+			want := "00-" + traceID + "-" + spanID + "-00"
+
+			if tt.wantSampled {
+				want = "00-" + traceID + "-" + spanID + "-01"
+			}
+
+			if got := sc.Traceparent(); got != want {
+				t.Errorf("got traceparent %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestStartContinuesTrace(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := New(exporter)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, parent := tracer.Start(ContextWithRemote(context.Background(), remote), "parent", SpanKindServer)
+	_, child := tracer.Start(ctx, "child", SpanKindClient)
+
+	child.End()
+	parent.End()
+
+	if parent.SpanContext.TraceID != remote.TraceID || parent.ParentID != remote.SpanID {
+		t.Errorf("got parent %+v; want a child of the remote span", parent.SpanContext)
+	}
+
+	if child.SpanContext.TraceID != remote.TraceID || child.ParentID != parent.SpanContext.SpanID {
+		t.Errorf("got child %+v; want a child of the parent span", child.SpanContext)
+	}
+
+	if len(exporter.spans) != 2 {
+		t.Errorf("got %d exported spans; want 2", len(exporter.spans))
+	}
+}
+
+type recordingExporter struct {
+	spans []*Span
+}
+
+func (e *recordingExporter) Export(span *Span) {
+	e.spans = append(e.spans, span)
+}
@@ -8,6 +8,9 @@ import (
 // Regular expression that defines what is a valid email addresss.
 var EmailRegEx = "^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$"
 
+// EmailRX is the compiled form of EmailRegEx for use with Matches.
+var EmailRX = regexp.MustCompile(EmailRegEx)
+
 // Define a new Validator type which contains a map of validation errors
 type Validator struct {
 	Errors map[string]string
@@ -61,3 +64,18 @@ func Unique[T comparable](values []T) bool {
 
 	return len(values) == len(uniqueValues)
 }
+
+// ExternalIDRX holds the format of the movie ids used by each external catalogue,
+// keyed by source.
+var ExternalIDRX = map[string]*regexp.Regexp{
+	"imdb": regexp.MustCompile("^tt[0-9]{7,9}$"),
+	"tmdb": regexp.MustCompile("^[1-9][0-9]{0,9}$"),
+}
+
+// ExternalID returns true if id is in the format used by the external source. Ids
+// from unknown sources are never valid.
+func ExternalID(source string, id string) bool {
+	rx, ok := ExternalIDRX[source]
+
+	return ok && rx.MatchString(id)
+}
@@ -0,0 +1,2 @@
+ALTER TABLE users
+DROP CONSTRAINT IF EXISTS users_email_key;
\ No newline at end of file
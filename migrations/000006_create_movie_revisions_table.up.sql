@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    movie_id BIGINT NOT NULL,
+    version INTEGER NOT NULL,
+    operation TEXT NOT NULL CHECK (operation IN ('insert', 'update', 'delete')),
+    old_values JSONB,
+    new_values JSONB,
+    user_id BIGINT REFERENCES users ON DELETE SET NULL,
+    request_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS movie_revisions_movie_id_version_idx ON movie_revisions (movie_id, version);
\ No newline at end of file
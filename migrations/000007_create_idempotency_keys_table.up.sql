@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key TEXT NOT NULL,
+    user_id BIGINT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    fingerprint BYTEA NOT NULL,
+    status INTEGER,
+    content_type TEXT NOT NULL DEFAULT '',
+    location TEXT NOT NULL DEFAULT '',
+    body BYTEA,
+    expiry TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (key, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expiry_idx ON idempotency_keys (expiry);
\ No newline at end of file
@@ -0,0 +1,16 @@
+ALTER TABLE movies
+ADD COLUMN genres TEXT[] NOT NULL DEFAULT '{}';
+
+UPDATE movies
+SET genres = movie_genres(id);
+
+ALTER TABLE movies
+ALTER COLUMN genres DROP DEFAULT;
+
+ALTER TABLE movies
+ADD CONSTRAINT movies_genres_length_check CHECK(ARRAY_LENGTH(genres, 1) BETWEEN 1 AND 5);
+
+DROP FUNCTION IF EXISTS movie_genre_slugs(BIGINT);
+DROP FUNCTION IF EXISTS movie_genres(BIGINT);
+DROP TABLE IF EXISTS movies_genres;
+DROP TABLE IF EXISTS genres;
\ No newline at end of file
@@ -0,0 +1,86 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    slug TEXT NOT NULL,
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    CONSTRAINT genres_slug_key UNIQUE (slug)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS genres_name_key ON genres (LOWER(name));
+
+CREATE TABLE IF NOT EXISTS movies_genres (
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    genre_id BIGINT NOT NULL REFERENCES genres ON DELETE RESTRICT,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (movie_id, genre_id)
+);
+
+CREATE INDEX IF NOT EXISTS movies_genres_genre_id_idx ON movies_genres (genre_id);
+
+-- Create a genre for every distinct genre already used by a movie. Variants which
+-- only differ by case or punctuation (like "Sci-Fi" and "sci-fi") share a slug and
+-- become a single genre, named after the most common variant. Genres without any
+-- ASCII letters or digits (like "???") have an empty slug, which can't tell them
+-- apart, so they are skipped and dropped from their movies.
+WITH used AS (
+    SELECT
+        genre,
+        TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(genre), '[^a-z0-9]+', '-', 'g')) AS slug
+    FROM
+        movies, UNNEST(genres) AS genre
+)
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (slug)
+    slug,
+    genre
+FROM
+    used
+WHERE
+    slug <> ''
+GROUP BY
+    slug, genre
+ORDER BY
+    slug, COUNT(*) DESC, genre;
+
+INSERT INTO movies_genres (movie_id, genre_id, position)
+SELECT DISTINCT ON (movies.id, genres.id)
+    movies.id,
+    genres.id,
+    movie_genre.position
+FROM
+    movies
+CROSS JOIN LATERAL
+    UNNEST(movies.genres) WITH ORDINALITY AS movie_genre(name, position)
+INNER JOIN
+    genres ON genres.slug = TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(movie_genre.name), '[^a-z0-9]+', '-', 'g'))
+ORDER BY
+    movies.id, genres.id, movie_genre.position;
+
+-- Dropping the column also drops the movies_genres_length_check constraint. The
+-- number of genres is checked by ValidateMovie instead.
+ALTER TABLE movies
+DROP COLUMN genres;
+
+-- The genre names and slugs of a movie, in the order they were given.
+CREATE OR REPLACE FUNCTION movie_genres(movie_id BIGINT) RETURNS TEXT[] AS $$
+    SELECT
+        COALESCE(ARRAY_AGG(genres.name ORDER BY movies_genres.position), '{}')
+    FROM
+        movies_genres
+    INNER JOIN
+        genres ON genres.id = movies_genres.genre_id
+    WHERE
+        movies_genres.movie_id = $1;
+$$ LANGUAGE SQL STABLE;
+
+CREATE OR REPLACE FUNCTION movie_genre_slugs(movie_id BIGINT) RETURNS TEXT[] AS $$
+    SELECT
+        COALESCE(ARRAY_AGG(genres.slug ORDER BY movies_genres.position), '{}')
+    FROM
+        movies_genres
+    INNER JOIN
+        genres ON genres.id = movies_genres.genre_id
+    WHERE
+        movies_genres.movie_id = $1;
+$$ LANGUAGE SQL STABLE;
\ No newline at end of file
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS people (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    name TEXT NOT NULL,
+    birth_year INTEGER,
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS people_name_idx ON people (LOWER(name));
+
+CREATE TABLE IF NOT EXISTS movie_credits (
+    id BIGSERIAL PRIMARY KEY,
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    person_id BIGINT NOT NULL REFERENCES people ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('director', 'writer', 'actor')),
+    character TEXT NOT NULL DEFAULT '',
+    billing_order INTEGER NOT NULL DEFAULT 0 CHECK (billing_order >= 0),
+    CONSTRAINT movie_credits_unique_key UNIQUE (movie_id, person_id, role, character)
+);
+
+CREATE INDEX IF NOT EXISTS movie_credits_person_id_idx ON movie_credits (person_id);
\ No newline at end of file
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS ratings_update_movie_rating ON ratings;
+DROP FUNCTION IF EXISTS update_movie_rating();
+DROP TABLE IF EXISTS ratings;
+
+ALTER TABLE movies
+DROP COLUMN IF EXISTS rating,
+DROP COLUMN IF EXISTS rating_count,
+DROP COLUMN IF EXISTS rating_sum;
\ No newline at end of file
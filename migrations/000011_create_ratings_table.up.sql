@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS ratings (
+    user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    rating INTEGER NOT NULL CHECK (rating BETWEEN 1 AND 10),
+    PRIMARY KEY (user_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS ratings_movie_id_idx ON ratings (movie_id);
+
+-- The sum and count of the ratings are kept on each movie so that the average
+-- doesn't have to be recomputed from the ratings table on every read.
+ALTER TABLE movies
+ADD COLUMN rating_sum BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN rating_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN rating NUMERIC(4, 2) GENERATED ALWAYS AS (
+    CASE WHEN rating_count = 0 THEN 0 ELSE rating_sum::NUMERIC / rating_count END
+) STORED;
+
+CREATE INDEX IF NOT EXISTS movies_rating_idx ON movies (rating);
+
+-- Apply the change made to each rating to the sum and count on its movie. Using a
+-- trigger means ratings removed by a cascading delete of a user are included too.
+CREATE OR REPLACE FUNCTION update_movie_rating() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE movies
+        SET rating_sum = rating_sum - OLD.rating, rating_count = rating_count - 1
+        WHERE id = OLD.movie_id;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE movies
+        SET rating_sum = rating_sum + NEW.rating, rating_count = rating_count + 1
+        WHERE id = NEW.movie_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ratings_update_movie_rating
+AFTER INSERT OR UPDATE OR DELETE ON ratings
+FOR EACH ROW EXECUTE FUNCTION update_movie_rating();
\ No newline at end of file
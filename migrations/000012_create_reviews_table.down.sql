@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS reviews;
+
+DELETE FROM permissions WHERE code = 'reviews:moderate';
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS reviews (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    version INTEGER NOT NULL DEFAULT 1,
+    CONSTRAINT reviews_movie_id_user_id_key UNIQUE (movie_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS reviews_status_idx ON reviews (status);
+
+INSERT INTO permissions (code)
+VALUES ('reviews:moderate');
\ No newline at end of file
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS lists (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    public BOOLEAN NOT NULL DEFAULT FALSE,
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS lists_user_id_idx ON lists (user_id);
+
+-- Items are ordered by position, starting at 1. The unique constraint on position
+-- is only checked at the end of each transaction, so that items can be shifted
+-- along the list one statement at a time.
+CREATE TABLE IF NOT EXISTS list_items (
+    list_id BIGINT NOT NULL REFERENCES lists ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    added_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    position INTEGER NOT NULL CHECK (position > 0),
+    PRIMARY KEY (list_id, movie_id),
+    CONSTRAINT list_items_position_key UNIQUE (list_id, position) DEFERRABLE INITIALLY DEFERRED
+);
+
+CREATE INDEX IF NOT EXISTS list_items_movie_id_idx ON list_items (movie_id);
\ No newline at end of file
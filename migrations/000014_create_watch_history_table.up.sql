@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS watch_history (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    watched_at TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS watch_history_user_id_watched_at_idx ON watch_history (user_id, watched_at);
\ No newline at end of file
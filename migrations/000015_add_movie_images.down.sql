@@ -0,0 +1,5 @@
+ALTER TABLE movies
+DROP COLUMN IF EXISTS backdrop_urls,
+DROP COLUMN IF EXISTS backdrop_key,
+DROP COLUMN IF EXISTS poster_urls,
+DROP COLUMN IF EXISTS poster_key;
\ No newline at end of file
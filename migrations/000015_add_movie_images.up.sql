@@ -0,0 +1,7 @@
+-- The key is the storage prefix the image files are stored under, and the URLs
+-- map each size of the image to the URL it can be fetched from.
+ALTER TABLE movies
+ADD COLUMN poster_key TEXT NOT NULL DEFAULT '',
+ADD COLUMN poster_urls JSONB,
+ADD COLUMN backdrop_key TEXT NOT NULL DEFAULT '',
+ADD COLUMN backdrop_urls JSONB;
\ No newline at end of file
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS collections (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+-- Movies are ordered within a collection by position, in the same way as the
+-- items of a list.
+CREATE TABLE IF NOT EXISTS collection_movies (
+    collection_id BIGINT NOT NULL REFERENCES collections ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    added_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    position INTEGER NOT NULL CHECK (position > 0),
+    PRIMARY KEY (collection_id, movie_id),
+    CONSTRAINT collection_movies_position_key UNIQUE (collection_id, position) DEFERRABLE INITIALLY DEFERRED
+);
+
+CREATE INDEX IF NOT EXISTS collection_movies_movie_id_idx ON collection_movies (movie_id);
+
+-- Each relation is stored in both directions, with the inverse type on the second
+-- row, so that the related movies of a movie can be found by movie_id alone. A row
+-- reads as "the related movie is the <type> of the movie".
+CREATE TABLE IF NOT EXISTS movie_relations (
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    related_movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('sequel', 'prequel', 'remake', 'original', 'spin_off', 'parent')),
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (movie_id, related_movie_id),
+    CHECK (movie_id <> related_movie_id)
+);
\ No newline at end of file
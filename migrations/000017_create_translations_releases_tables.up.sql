@@ -0,0 +1,20 @@
+-- Locales are stored in lowercase, like "fr" or "pt-br", so that they can be
+-- compared with the Accept-Language header without worrying about case.
+CREATE TABLE IF NOT EXISTS movie_translations (
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    locale TEXT NOT NULL,
+    title TEXT NOT NULL,
+    overview TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (movie_id, locale)
+);
+
+-- Countries are ISO 3166-1 alpha-2 codes in uppercase, like "GB".
+CREATE TABLE IF NOT EXISTS movie_releases (
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    country TEXT NOT NULL,
+    date DATE NOT NULL,
+    certification TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (movie_id, country)
+);
+
+CREATE INDEX IF NOT EXISTS movie_releases_country_idx ON movie_releases (country);
\ No newline at end of file
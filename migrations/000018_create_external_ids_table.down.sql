@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS movie_external_ids(BIGINT);
+DROP TABLE IF EXISTS external_ids;
\ No newline at end of file
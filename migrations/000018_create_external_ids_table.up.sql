@@ -0,0 +1,20 @@
+-- An external id is the id of a movie in another catalogue, like IMDb. Each id can
+-- only be mapped to one movie, and each movie can only have one id per source.
+CREATE TABLE IF NOT EXISTS external_ids (
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (source, value),
+    CONSTRAINT external_ids_movie_id_source_key UNIQUE (movie_id, source)
+);
+
+-- The external ids of a movie as a JSON object keyed by source, or NULL if it has
+-- none.
+CREATE OR REPLACE FUNCTION movie_external_ids(movie_id BIGINT) RETURNS JSONB AS $$
+    SELECT
+        JSONB_OBJECT_AGG(source, value)
+    FROM
+        external_ids
+    WHERE
+        external_ids.movie_id = $1;
+$$ LANGUAGE SQL STABLE;
\ No newline at end of file
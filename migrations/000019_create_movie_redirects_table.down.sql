@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS movie_redirects;
+DROP INDEX IF EXISTS movies_normalized_title_year_idx;
+DROP FUNCTION IF EXISTS normalize_title(TEXT);
+
+DELETE FROM permissions WHERE code = 'movies:merge';
\ No newline at end of file
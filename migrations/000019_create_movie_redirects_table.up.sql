@@ -0,0 +1,25 @@
+-- The title of a movie reduced to lowercase letters and digits, without a leading
+-- article, so that "The Matrix" and "Matrix, The" aren't told apart by case or
+-- punctuation. Movies with the same normalized title are duplicate candidates.
+CREATE OR REPLACE FUNCTION normalize_title(title TEXT) RETURNS TEXT AS $$
+    SELECT
+        REGEXP_REPLACE(
+            REGEXP_REPLACE(LOWER($1), '^(the|a|an)\s+|,\s*(the|a|an)$', '', 'g'),
+            '[^[:alnum:]]+', '', 'g'
+        );
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS movies_normalized_title_year_idx ON movies (normalize_title(title), year);
+
+-- When a movie is merged into another its id is kept here, so that requests for
+-- the old id can be redirected to the movie it was merged into.
+CREATE TABLE IF NOT EXISTS movie_redirects (
+    id BIGINT PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS movie_redirects_movie_id_idx ON movie_redirects (movie_id);
+
+INSERT INTO permissions (code)
+VALUES ('movies:merge');
\ No newline at end of file
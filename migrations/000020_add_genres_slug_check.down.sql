@@ -0,0 +1,2 @@
+ALTER TABLE genres
+DROP CONSTRAINT IF EXISTS genres_slug_check;
@@ -0,0 +1,9 @@
+-- Before slugs were required, a genre created through the API with a name without
+-- any ASCII letters or digits was given an empty slug, so it is given one based on
+-- its id first.
+UPDATE genres
+SET slug = 'genre-' || id
+WHERE slug = '';
+
+ALTER TABLE genres
+ADD CONSTRAINT genres_slug_check CHECK(slug <> '');
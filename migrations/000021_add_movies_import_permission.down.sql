@@ -0,0 +1 @@
+DELETE FROM permissions WHERE code = 'movies:import';
\ No newline at end of file
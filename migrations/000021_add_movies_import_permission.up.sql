@@ -0,0 +1,2 @@
+INSERT INTO permissions (code)
+VALUES ('movies:import');
\ No newline at end of file
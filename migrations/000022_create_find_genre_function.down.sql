@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS find_genre(TEXT);
\ No newline at end of file
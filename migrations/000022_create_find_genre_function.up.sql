@@ -0,0 +1,16 @@
+-- The id of the genre which a genre name given by a client refers to, in the same
+-- way as GenreSet.Find(): the genre with the same name ignoring case, or else the
+-- genre whose slug is the slug of the name. NULL is returned if there is none.
+CREATE OR REPLACE FUNCTION find_genre(name TEXT) RETURNS BIGINT AS $$
+    SELECT
+        genres.id
+    FROM
+        genres
+    WHERE
+        LOWER(genres.name) = LOWER($1)
+    OR
+        genres.slug = TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER($1), '[^a-z0-9]+', '-', 'g'))
+    ORDER BY
+        LOWER(genres.name) = LOWER($1) DESC
+    LIMIT 1;
+$$ LANGUAGE SQL STABLE;
\ No newline at end of file
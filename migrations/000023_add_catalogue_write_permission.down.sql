@@ -0,0 +1 @@
+DELETE FROM permissions WHERE code = 'catalogue:write';
\ No newline at end of file
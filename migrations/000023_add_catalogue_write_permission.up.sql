@@ -0,0 +1,2 @@
+INSERT INTO permissions (code)
+VALUES ('catalogue:write');
\ No newline at end of file